@@ -1,75 +1,138 @@
 package auth
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"fmt"
 	"time"
 
 	jwt "github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 	"github.com/rekram1-node/workout-backend/models"
 )
 
+const (
+	PurposeAccess       = "access"
+	PurposeMFAChallenge = "mfa_challenge"
+
+	MFAChallengeTTL = 5 * time.Minute
+)
+
 type JwtCustomClaims struct {
 	Name string
 	UUID string
+	Role string `json:"role,omitempty"`
+	// Scopes is what the token may be used for, see ScopesForRole
+	Scopes []string `json:"scp,omitempty"`
+	// SessionID is the refresh token family the access token was issued for
+	SessionID string `json:"sid,omitempty"`
+	// Purpose keeps tokens from being used where they weren't meant to be,
+	// e.g. an mfa challenge as an access token
+	Purpose string `json:"purpose"`
+	// Actor is set when an admin is acting as the user
+	Actor *Actor `json:"act,omitempty"`
 	jwt.RegisteredClaims
 }
 
-func CreateAccessToken(user *models.User, secret string) (string, error) {
-	exp := time.Now().Add(time.Hour * 72)
-	claims := &JwtCustomClaims{
-		user.Username,
-		user.UUID,
-		jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(exp),
-		},
-	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+// Actor is the RFC 8693 act claim
+type Actor struct {
+	Subject string `json:"sub"`
+}
 
-	return token.SignedString([]byte(secret))
+type TokenConfig struct {
+	Keyring         *Keyring
+	AccessTokenTTL  time.Duration
+	RefreshTokenTTL time.Duration
 }
 
-func CreateRefreshToken(user *models.User, secret string) (string, error) {
-	exp := time.Now().Add(time.Hour * 72)
+func CreateAccessToken(user *models.User, sessionID string, tokens TokenConfig) (string, error) {
+	return createToken(user, sessionID, PurposeAccess, tokens.AccessTokenTTL, tokens.Keyring)
+}
+
+// CreateMFAChallenge signs the short lived token handed out after a correct
+// password when the user has two factor authentication enabled. It can only
+// be exchanged for real tokens together with a code.
+func CreateMFAChallenge(user *models.User, tokens TokenConfig) (string, error) {
+	return createToken(user, "", PurposeMFAChallenge, MFAChallengeTTL, tokens.Keyring)
+}
+
+// CreateImpersonationToken signs an access token for user on behalf of the
+// admin with actorUUID. It has no session or refresh token and can't be used
+// to manage the account. The token and its ID are returned.
+func CreateImpersonationToken(user *models.User, actorUUID string, ttl time.Duration, keyring *Keyring) (string, string, error) {
+	claims := newClaims(user, "", PurposeAccess, ttl)
+	claims.Scopes = TokenScopes
+	claims.Actor = &Actor{Subject: actorUUID}
+	token, err := keyring.Sign(claims)
+
+	return token, claims.ID, err
+}
+
+func createToken(user *models.User, sessionID, purpose string, ttl time.Duration, keyring *Keyring) (string, error) {
+	return keyring.Sign(newClaims(user, sessionID, purpose, ttl))
+}
+
+func newClaims(user *models.User, sessionID, purpose string, ttl time.Duration) *JwtCustomClaims {
+	now := time.Now()
 	claims := &JwtCustomClaims{
-		user.Username,
-		user.UUID,
-		jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(exp),
+		Name:      user.Username,
+		UUID:      user.UUID,
+		SessionID: sessionID,
+		Purpose:   purpose,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.NewString(),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
 		},
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	if purpose == PurposeAccess {
+		claims.Role = user.Role
+		claims.Scopes = ScopesForRole(user.Role)
+	}
 
-	return token.SignedString([]byte(secret))
+	return claims
 }
 
-func IsAuthorized(token string, secret string) (bool, error) {
-	_, err := jwt.Parse(token, func(t *jwt.Token) (interface{}, error) {
-		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
-		}
-
-		return []byte(secret), nil
-	})
-
-	if err != nil {
-		return false, err
+// CreateOpaqueToken returns a new random token (refresh tokens, password
+// reset tokens) along with the hash it is stored under. Only the hash is ever
+// persisted.
+func CreateOpaqueToken() (string, string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", fmt.Errorf("failed to generate token: %w", err)
 	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+
+	return token, HashOpaqueToken(token), nil
+}
 
-	return true, nil
+// HashOpaqueToken is a plain SHA-256, opaque tokens are 256 random bits so
+// they do not need a slow password hash.
+func HashOpaqueToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
 }
 
-func ReadUUIDFromToken(token string, secret string) (string, error) {
-	t, err := jwt.ParseWithClaims(token, &JwtCustomClaims{}, func(t *jwt.Token) (interface{}, error) {
-		return []byte(secret), nil
-	})
+// ParseToken verifies the signature, expiry and purpose of token and returns
+// its claims.
+func ParseToken(token string, keyring *Keyring, purpose string) (*JwtCustomClaims, error) {
+	t, err := jwt.ParseWithClaims(token, &JwtCustomClaims{}, keyring.Keyfunc)
 
 	if err != nil {
-		return "", fmt.Errorf("failed to parse token %w", err)
+		return nil, fmt.Errorf("failed to parse token %w", err)
 	}
 
 	if claims, ok := t.Claims.(*JwtCustomClaims); ok && t.Valid {
-		return claims.UUID, nil
+		if claims.ID == "" || claims.IssuedAt == nil || claims.ExpiresAt == nil {
+			return nil, fmt.Errorf("token is missing jti, iat or exp claims, sign in again")
+		}
+		if claims.Purpose != purpose {
+			return nil, fmt.Errorf("token can not be used for %s", purpose)
+		}
+		return claims, nil
 	}
 
-	return "", fmt.Errorf("invalid token or missing claims")
+	return nil, fmt.Errorf("invalid token or missing claims")
 }
@@ -0,0 +1,282 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"os"
+	"sort"
+	"time"
+
+	jwt "github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	HS256 = "HS256"
+	RS256 = "RS256"
+	EdDSA = "EdDSA"
+
+	// LegacyKeyID identifies the JWT_SECRET key, tokens signed before key
+	// rotation existed have no kid header and are verified with it.
+	LegacyKeyID = "default"
+)
+
+type SigningKey struct {
+	ID        string
+	Algorithm string
+	// RetiredAt stops a key from being used once the keyring grace window
+	// has passed, retired keys are never used to sign
+	RetiredAt *time.Time
+
+	method     jwt.SigningMethod
+	signingKey interface{}
+	verifyKey  interface{}
+}
+
+// Keyring holds every key tokens can be verified with and the one active
+// key new tokens are signed with.
+type Keyring struct {
+	active string
+	keys   map[string]*SigningKey
+	grace  time.Duration
+}
+
+type keyFile struct {
+	Active string          `json:"active"`
+	Keys   []keyFileRecord `json:"keys"`
+}
+
+type keyFileRecord struct {
+	ID         string     `json:"kid"`
+	Algorithm  string     `json:"alg"`
+	Secret     string     `json:"secret"`
+	PrivateKey string     `json:"private_key"`
+	RetiredAt  *time.Time `json:"retired_at"`
+}
+
+// LoadKeyring builds a keyring from the legacy JWT_SECRET plus key sets in
+// the key file format, given inline (JWT_KEYS) and/or as a file path
+// (JWT_KEY_FILE). The last key set naming an active key wins.
+func LoadKeyring(secret, inline, path string, grace time.Duration) (*Keyring, error) {
+	keyring := &Keyring{
+		keys:  make(map[string]*SigningKey),
+		grace: grace,
+	}
+
+	if secret != "" {
+		if err := keyring.add(keyFileRecord{ID: LegacyKeyID, Algorithm: HS256, Secret: secret}); err != nil {
+			return nil, err
+		}
+		keyring.active = LegacyKeyID
+	}
+
+	if inline != "" {
+		if err := keyring.load([]byte(inline)); err != nil {
+			return nil, err
+		}
+	}
+
+	if path != "" {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read key file: %w", err)
+		}
+		if err := keyring.load(b); err != nil {
+			return nil, err
+		}
+	}
+
+	active, ok := keyring.keys[keyring.active]
+	switch {
+	case !ok:
+		return nil, fmt.Errorf("no active signing key, set JWT_SECRET or an active key in the key set")
+	case active.RetiredAt != nil:
+		return nil, fmt.Errorf("active signing key %s is retired", active.ID)
+	}
+
+	return keyring, nil
+}
+
+func (k *Keyring) load(b []byte) error {
+	var file keyFile
+	if err := json.Unmarshal(b, &file); err != nil {
+		return fmt.Errorf("failed to parse key set: %w", err)
+	}
+
+	for _, record := range file.Keys {
+		if record.Algorithm == HS256 && len(record.Secret) < 32 {
+			return fmt.Errorf("key %s: HS256 secrets must be at least 32 bytes", record.ID)
+		}
+		if err := k.add(record); err != nil {
+			return err
+		}
+	}
+
+	if file.Active != "" {
+		k.active = file.Active
+	}
+
+	return nil
+}
+
+func (k *Keyring) add(record keyFileRecord) error {
+	if record.ID == "" {
+		return fmt.Errorf("key is missing a kid")
+	}
+	if _, ok := k.keys[record.ID]; ok {
+		return fmt.Errorf("duplicate key id: %s", record.ID)
+	}
+
+	key := &SigningKey{
+		ID:        record.ID,
+		Algorithm: record.Algorithm,
+		RetiredAt: record.RetiredAt,
+	}
+
+	switch record.Algorithm {
+	case HS256:
+		if record.Secret == "" {
+			return fmt.Errorf("key %s: HS256 requires a secret", record.ID)
+		}
+		key.method = jwt.SigningMethodHS256
+		key.signingKey = []byte(record.Secret)
+		key.verifyKey = []byte(record.Secret)
+	case RS256:
+		private, err := parsePrivateKey(record.PrivateKey)
+		if err != nil {
+			return fmt.Errorf("key %s: %w", record.ID, err)
+		}
+		rsaKey, ok := private.(*rsa.PrivateKey)
+		if !ok {
+			return fmt.Errorf("key %s: RS256 requires an RSA private key", record.ID)
+		}
+		key.method = jwt.SigningMethodRS256
+		key.signingKey = rsaKey
+		key.verifyKey = &rsaKey.PublicKey
+	case EdDSA:
+		private, err := parsePrivateKey(record.PrivateKey)
+		if err != nil {
+			return fmt.Errorf("key %s: %w", record.ID, err)
+		}
+		edKey, ok := private.(ed25519.PrivateKey)
+		if !ok {
+			return fmt.Errorf("key %s: EdDSA requires an Ed25519 private key", record.ID)
+		}
+		key.method = jwt.SigningMethodEdDSA
+		key.signingKey = edKey
+		key.verifyKey = edKey.Public()
+	default:
+		return fmt.Errorf("key %s: unsupported algorithm %q", record.ID, record.Algorithm)
+	}
+
+	k.keys[key.ID] = key
+	return nil
+}
+
+func parsePrivateKey(encoded string) (interface{}, error) {
+	block, _ := pem.Decode([]byte(encoded))
+	if block == nil {
+		return nil, fmt.Errorf("private_key is not PEM encoded")
+	}
+
+	if key, err := x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+
+	return x509.ParsePKCS1PrivateKey(block.Bytes)
+}
+
+// Sign signs claims with the active key and sets the kid header
+func (k *Keyring) Sign(claims jwt.Claims) (string, error) {
+	key := k.keys[k.active]
+	token := jwt.NewWithClaims(key.method, claims)
+	token.Header["kid"] = key.ID
+
+	return token.SignedString(key.signingKey)
+}
+
+// Keyfunc resolves the verification key of a token from its kid header,
+// rejecting unknown kids, algorithm mismatches and keys past their grace window.
+func (k *Keyring) Keyfunc(t *jwt.Token) (interface{}, error) {
+	kid, _ := t.Header["kid"].(string)
+	if kid == "" {
+		kid = LegacyKeyID
+	}
+
+	key, ok := k.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key: %s", kid)
+	}
+	if t.Method.Alg() != key.method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
+	}
+	if !k.usable(key) {
+		return nil, fmt.Errorf("signing key %s has been retired", kid)
+	}
+
+	return key.verifyKey, nil
+}
+
+func (k *Keyring) usable(key *SigningKey) bool {
+	return key.RetiredAt == nil || time.Now().Before(key.RetiredAt.Add(k.grace))
+}
+
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Algorithm string `json:"alg"`
+	Use       string `json:"use"`
+	// RSA
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// Ed25519
+	Curve string `json:"crv,omitempty"`
+	X     string `json:"x,omitempty"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS publishes the public half of every usable asymmetric key. HMAC keys
+// are shared secrets and never published.
+func (k *Keyring) JWKS() JWKS {
+	jwks := JWKS{Keys: []JWK{}}
+	for _, key := range k.keys {
+		if !k.usable(key) {
+			continue
+		}
+
+		switch public := key.verifyKey.(type) {
+		case *rsa.PublicKey:
+			jwks.Keys = append(jwks.Keys, JWK{
+				KeyType:   "RSA",
+				KeyID:     key.ID,
+				Algorithm: key.Algorithm,
+				Use:       "sig",
+				N:         base64.RawURLEncoding.EncodeToString(public.N.Bytes()),
+				E:         base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes()),
+			})
+		case ed25519.PublicKey:
+			jwks.Keys = append(jwks.Keys, JWK{
+				KeyType:   "OKP",
+				KeyID:     key.ID,
+				Algorithm: key.Algorithm,
+				Use:       "sig",
+				Curve:     "Ed25519",
+				X:         base64.RawURLEncoding.EncodeToString(public),
+			})
+		}
+	}
+
+	sort.Slice(jwks.Keys, func(i, j int) bool {
+		return jwks.Keys[i].KeyID < jwks.Keys[j].KeyID
+	})
+
+	return jwks
+}
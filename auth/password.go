@@ -0,0 +1,212 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	Argon2id = "argon2id"
+	Bcrypt   = "bcrypt"
+)
+
+var ErrInvalidHash = errors.New("invalid password hash")
+
+// PasswordHasher hashes passwords for storage and verifies them at sign in.
+// NeedsRehash reports whether a stored hash was produced by a different
+// algorithm or with weaker parameters than the hasher currently uses.
+type PasswordHasher interface {
+	Hash(password string) (string, error)
+	Verify(password, encoded string) (bool, error)
+	NeedsRehash(encoded string) bool
+}
+
+type Argon2idHasher struct {
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// DefaultArgon2id follows the OWASP recommendation for argon2id.
+var DefaultArgon2id = Argon2idHasher{
+	Memory:      64 * 1024,
+	Iterations:  3,
+	Parallelism: 2,
+	SaltLength:  16,
+	KeyLength:   32,
+}
+
+func (h Argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, h.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("failed to generate salt: %w", err)
+	}
+
+	key := argon2.IDKey([]byte(password), salt, h.Iterations, h.Memory, h.Parallelism, h.KeyLength)
+
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, h.Memory, h.Iterations, h.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+func (h Argon2idHasher) Verify(password, encoded string) (bool, error) {
+	params, salt, key, err := decodeArgon2id(encoded)
+	if err != nil {
+		return false, err
+	}
+
+	other := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, params.KeyLength)
+
+	return subtle.ConstantTimeCompare(key, other) == 1, nil
+}
+
+func (h Argon2idHasher) NeedsRehash(encoded string) bool {
+	params, salt, _, err := decodeArgon2id(encoded)
+	if err != nil {
+		return true
+	}
+
+	return params.Memory < h.Memory ||
+		params.Iterations < h.Iterations ||
+		params.Parallelism != h.Parallelism ||
+		params.KeyLength < h.KeyLength ||
+		uint32(len(salt)) < h.SaltLength
+}
+
+func decodeArgon2id(encoded string) (Argon2idHasher, []byte, []byte, error) {
+	var params Argon2idHasher
+	// "", "argon2id", "v=19", "m=65536,t=3,p=2", salt, key
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != Argon2id {
+		return params, nil, nil, ErrInvalidHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return params, nil, nil, ErrInvalidHash
+	}
+
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism); err != nil {
+		return params, nil, nil, ErrInvalidHash
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return params, nil, nil, ErrInvalidHash
+	}
+
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return params, nil, nil, ErrInvalidHash
+	}
+
+	params.SaltLength = uint32(len(salt))
+	params.KeyLength = uint32(len(key))
+
+	return params, salt, key, nil
+}
+
+type BcryptHasher struct {
+	Cost int
+}
+
+func (h BcryptHasher) Hash(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), h.Cost)
+	if err != nil {
+		return "", err
+	}
+
+	return string(hash), nil
+}
+
+func (h BcryptHasher) Verify(password, encoded string) (bool, error) {
+	err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+	switch {
+	case errors.Is(err, bcrypt.ErrMismatchedHashAndPassword):
+		return false, nil
+	case err != nil:
+		return false, fmt.Errorf("%w: %v", ErrInvalidHash, err)
+	}
+
+	return true, nil
+}
+
+func (h BcryptHasher) NeedsRehash(encoded string) bool {
+	cost, err := bcrypt.Cost([]byte(encoded))
+
+	return err != nil || cost < h.Cost
+}
+
+// Passwords hashes new passwords with the preferred algorithm and verifies
+// hashes from any supported algorithm, so the algorithm or its parameters can
+// change without locking anyone out. Stored values that are not a recognised
+// hash are treated as legacy plaintext passwords and always need a rehash.
+type Passwords struct {
+	preferred string
+	argon2id  Argon2idHasher
+	bcrypt    BcryptHasher
+}
+
+func NewPasswords(algorithm string, argon2idHasher Argon2idHasher, bcryptHasher BcryptHasher) (*Passwords, error) {
+	if algorithm != Argon2id && algorithm != Bcrypt {
+		return nil, fmt.Errorf("unsupported password hash algorithm: %s", algorithm)
+	}
+
+	return &Passwords{
+		preferred: algorithm,
+		argon2id:  argon2idHasher,
+		bcrypt:    bcryptHasher,
+	}, nil
+}
+
+func (p *Passwords) Hash(password string) (string, error) {
+	if p.preferred == Bcrypt {
+		return p.bcrypt.Hash(password)
+	}
+
+	return p.argon2id.Hash(password)
+}
+
+func (p *Passwords) Verify(password, encoded string) (bool, error) {
+	switch algorithmOf(encoded) {
+	case Argon2id:
+		return p.argon2id.Verify(password, encoded)
+	case Bcrypt:
+		return p.bcrypt.Verify(password, encoded)
+	default:
+		return subtle.ConstantTimeCompare([]byte(password), []byte(encoded)) == 1, nil
+	}
+}
+
+func (p *Passwords) NeedsRehash(encoded string) bool {
+	if algorithmOf(encoded) != p.preferred {
+		return true
+	}
+	if p.preferred == Bcrypt {
+		return p.bcrypt.NeedsRehash(encoded)
+	}
+
+	return p.argon2id.NeedsRehash(encoded)
+}
+
+func algorithmOf(encoded string) string {
+	switch {
+	case strings.HasPrefix(encoded, "$argon2id$"):
+		return Argon2id
+	case strings.HasPrefix(encoded, "$2a$"), strings.HasPrefix(encoded, "$2b$"), strings.HasPrefix(encoded, "$2y$"):
+		return Bcrypt
+	default:
+		return ""
+	}
+}
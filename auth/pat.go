@@ -0,0 +1,32 @@
+package auth
+
+import (
+	"errors"
+	"strings"
+)
+
+// PersonalAccessTokenPrefix tells personal access tokens apart from JWTs in
+// the Authorization header and makes leaked tokens easy to search for
+const PersonalAccessTokenPrefix = "wbp_"
+
+var ErrPersonalAccessTokenInvalid = errors.New("invalid or expired personal access token")
+
+// personalAccessTokenHint is how much of a token is kept in the clear so
+// users can tell their tokens apart
+const personalAccessTokenHint = len(PersonalAccessTokenPrefix) + 8
+
+// CreatePersonalAccessToken returns a new token, its hash and the hint that
+// can be shown in token listings
+func CreatePersonalAccessToken() (string, string, string, error) {
+	random, _, err := CreateOpaqueToken()
+	if err != nil {
+		return "", "", "", err
+	}
+	token := PersonalAccessTokenPrefix + random
+
+	return token, HashOpaqueToken(token), token[:personalAccessTokenHint], nil
+}
+
+func IsPersonalAccessToken(token string) bool {
+	return strings.HasPrefix(token, PersonalAccessTokenPrefix)
+}
@@ -0,0 +1,46 @@
+package auth
+
+import (
+	"context"
+	"time"
+)
+
+type AuthMethod string
+
+const (
+	AuthMethodJWT AuthMethod = "jwt"
+	AuthMethodPAT AuthMethod = "pat"
+)
+
+// Principal is the authenticated caller of a request. It is only ever built
+// by the authentication middleware from a verified credential.
+type Principal struct {
+	UserUUID string
+	Username string
+	Role     string
+	TokenID  string
+	Scopes   []string
+	Method   AuthMethod
+
+	SessionID string
+	IssuedAt  time.Time
+	ExpiresAt time.Time
+
+	// ActorUUID is the admin impersonating the user, if any
+	ActorUUID string
+}
+
+type principalKey struct{}
+
+func WithPrincipal(ctx context.Context, principal *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+func PrincipalFromContext(ctx context.Context) (*Principal, bool) {
+	principal, ok := ctx.Value(principalKey{}).(*Principal)
+	if !ok || principal == nil || principal.UserUUID == "" {
+		return nil, false
+	}
+
+	return principal, true
+}
@@ -0,0 +1,56 @@
+package auth
+
+const (
+	ScopeMesoRead  = "meso:read"
+	ScopeMesoWrite = "meso:write"
+	ScopeUserRead  = "user:read"
+	ScopeUserWrite = "user:write"
+	// ScopeAccount covers credentials, sessions and tokens. It is never
+	// granted to a personal access token.
+	ScopeAccount = "account"
+	// ScopeAdmin is only in access tokens of admins, so an admin's personal
+	// access tokens can't reach admin routes
+	ScopeAdmin = "admin"
+)
+
+const (
+	RoleUser = "user"
+	// RoleCoach can add exercises to the global catalog, along with admins
+	RoleCoach = "coach"
+	RoleAdmin = "admin"
+)
+
+// TokenScopes are the scopes a personal access token can be created with
+var TokenScopes = []string{ScopeMesoRead, ScopeMesoWrite, ScopeUserRead, ScopeUserWrite}
+
+// SessionScopes are the scopes of a user signed in with a password
+var SessionScopes = append(append([]string{}, TokenScopes...), ScopeAccount)
+
+// ScopesForRole are the scopes of an access token issued to a user with role
+func ScopesForRole(role string) []string {
+	if role == RoleAdmin {
+		return append(append([]string{}, SessionScopes...), ScopeAdmin)
+	}
+
+	return SessionScopes
+}
+
+func (p *Principal) HasScope(scope string) bool {
+	for _, s := range p.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (p *Principal) HasRole(roles ...string) bool {
+	for _, role := range roles {
+		if p.Role == role {
+			return true
+		}
+	}
+
+	return false
+}
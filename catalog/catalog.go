@@ -0,0 +1,166 @@
+// Package catalog holds the global exercise catalog that is seeded into the
+// database and matches free text exercise names onto it.
+package catalog
+
+import (
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/rekram1-node/workout-backend/models"
+)
+
+// Muscle groups
+const (
+	Chest      = "chest"
+	Back       = "back"
+	Traps      = "traps"
+	FrontDelts = "front_delts"
+	SideDelts  = "side_delts"
+	RearDelts  = "rear_delts"
+	Biceps     = "biceps"
+	Triceps    = "triceps"
+	Forearms   = "forearms"
+	Quads      = "quads"
+	Hamstrings = "hamstrings"
+	Glutes     = "glutes"
+	Calves     = "calves"
+	Abs        = "abs"
+)
+
+// Muscles lists every muscle group
+var Muscles = []string{Chest, Back, Traps, FrontDelts, SideDelts, RearDelts, Biceps, Triceps, Forearms, Quads, Hamstrings, Glutes, Calves, Abs}
+
+// Equipment
+const (
+	Barbell    = "barbell"
+	Dumbbell   = "dumbbell"
+	Machine    = "machine"
+	Cable      = "cable"
+	Bodyweight = "bodyweight"
+	Smith      = "smith_machine"
+	Kettlebell = "kettlebell"
+	Band       = "band"
+)
+
+// EquipmentTypes lists every kind of equipment
+var EquipmentTypes = []string{Barbell, Dumbbell, Machine, Cable, Bodyweight, Smith, Kettlebell, Band}
+
+// Movement patterns
+const (
+	HorizontalPush = "horizontal_push"
+	VerticalPush   = "vertical_push"
+	HorizontalPull = "horizontal_pull"
+	VerticalPull   = "vertical_pull"
+	Squat          = "squat"
+	Hinge          = "hinge"
+	Lunge          = "lunge"
+	Isolation      = "isolation"
+	Core           = "core"
+)
+
+// Movements lists every movement pattern
+var Movements = []string{HorizontalPush, VerticalPush, HorizontalPull, VerticalPull, Squat, Hinge, Lunge, Isolation, Core}
+
+// namespace keeps seeded UUIDs the same in every database
+var namespace = uuid.MustParse("8f0e7c1a-3d5b-4c2e-9a61-2b7d4e9f0c13")
+
+type entry struct {
+	name       string
+	primary    []string
+	secondary  []string
+	equipment  string
+	movement   string
+	unilateral bool
+	aliases    []string
+}
+
+var entries = []entry{
+	{"Barbell Back Squat", []string{Quads, Glutes}, []string{Hamstrings}, Barbell, Squat, false, []string{"Squat", "Back Squat", "BB Squat"}},
+	{"Barbell Front Squat", []string{Quads}, []string{Glutes, Abs}, Barbell, Squat, false, []string{"Front Squat"}},
+	{"Hack Squat", []string{Quads}, []string{Glutes}, Machine, Squat, false, []string{"Machine Hack Squat"}},
+	{"Leg Press", []string{Quads}, []string{Glutes}, Machine, Squat, false, []string{"45 Degree Leg Press"}},
+	{"Smith Machine Squat", []string{Quads}, []string{Glutes}, Smith, Squat, false, []string{"Smith Squat"}},
+	{"Goblet Squat", []string{Quads}, []string{Glutes}, Dumbbell, Squat, false, nil},
+	{"Bulgarian Split Squat", []string{Quads, Glutes}, nil, Dumbbell, Lunge, true, []string{"BSS", "Split Squat"}},
+	{"Walking Lunge", []string{Quads, Glutes}, nil, Dumbbell, Lunge, true, []string{"Lunge", "Lunges", "DB Lunge"}},
+	{"Leg Extension", []string{Quads}, nil, Machine, Isolation, false, []string{"Leg Extensions", "Quad Extension"}},
+	{"Conventional Deadlift", []string{Hamstrings, Glutes, Back}, []string{Traps, Forearms}, Barbell, Hinge, false, []string{"Deadlift", "DL"}},
+	{"Romanian Deadlift", []string{Hamstrings, Glutes}, []string{Back}, Barbell, Hinge, false, []string{"RDL", "Stiff Leg Deadlift", "SLDL"}},
+	{"Dumbbell Romanian Deadlift", []string{Hamstrings, Glutes}, []string{Back}, Dumbbell, Hinge, false, []string{"DB RDL"}},
+	{"Hip Thrust", []string{Glutes}, []string{Hamstrings}, Barbell, Hinge, false, []string{"Barbell Hip Thrust", "Glute Bridge"}},
+	{"Lying Leg Curl", []string{Hamstrings}, nil, Machine, Isolation, false, []string{"Leg Curl", "Hamstring Curl"}},
+	{"Seated Leg Curl", []string{Hamstrings}, nil, Machine, Isolation, false, nil},
+	{"Standing Calf Raise", []string{Calves}, nil, Machine, Isolation, false, []string{"Calf Raise", "Calf Raises"}},
+	{"Seated Calf Raise", []string{Calves}, nil, Machine, Isolation, false, nil},
+	{"Barbell Bench Press", []string{Chest}, []string{FrontDelts, Triceps}, Barbell, HorizontalPush, false, []string{"Bench Press", "Bench", "BB Bench", "Flat Bench"}},
+	{"Incline Barbell Bench Press", []string{Chest}, []string{FrontDelts, Triceps}, Barbell, HorizontalPush, false, []string{"Incline Bench", "Incline Bench Press"}},
+	{"Dumbbell Bench Press", []string{Chest}, []string{FrontDelts, Triceps}, Dumbbell, HorizontalPush, false, []string{"DB Bench", "DB Bench Press", "Dumbbell Bench", "Flat DB Press"}},
+	{"Incline Dumbbell Press", []string{Chest}, []string{FrontDelts, Triceps}, Dumbbell, HorizontalPush, false, []string{"Incline DB Press", "Incline Dumbbell Bench"}},
+	{"Machine Chest Press", []string{Chest}, []string{FrontDelts, Triceps}, Machine, HorizontalPush, false, []string{"Chest Press"}},
+	{"Dip", []string{Chest, Triceps}, []string{FrontDelts}, Bodyweight, VerticalPush, false, []string{"Dips", "Chest Dip"}},
+	{"Push Up", []string{Chest}, []string{FrontDelts, Triceps}, Bodyweight, HorizontalPush, false, []string{"Pushup", "Push Ups", "Press Up"}},
+	{"Cable Fly", []string{Chest}, nil, Cable, Isolation, false, []string{"Cable Flye", "Cable Crossover"}},
+	{"Dumbbell Fly", []string{Chest}, nil, Dumbbell, Isolation, false, []string{"DB Fly", "Dumbbell Flye"}},
+	{"Pec Deck", []string{Chest}, nil, Machine, Isolation, false, []string{"Machine Fly"}},
+	{"Overhead Press", []string{FrontDelts}, []string{SideDelts, Triceps}, Barbell, VerticalPush, false, []string{"OHP", "Military Press", "Standing Press", "Shoulder Press"}},
+	{"Dumbbell Shoulder Press", []string{FrontDelts}, []string{SideDelts, Triceps}, Dumbbell, VerticalPush, false, []string{"DB Shoulder Press", "Seated Dumbbell Press"}},
+	{"Machine Shoulder Press", []string{FrontDelts}, []string{SideDelts, Triceps}, Machine, VerticalPush, false, nil},
+	{"Dumbbell Lateral Raise", []string{SideDelts}, nil, Dumbbell, Isolation, false, []string{"Lateral Raise", "Side Raise", "Lat Raise", "DB Lateral Raise"}},
+	{"Cable Lateral Raise", []string{SideDelts}, nil, Cable, Isolation, true, nil},
+	{"Reverse Pec Deck", []string{RearDelts}, nil, Machine, Isolation, false, []string{"Reverse Fly", "Rear Delt Fly"}},
+	{"Face Pull", []string{RearDelts}, []string{Traps}, Cable, HorizontalPull, false, []string{"Face Pulls"}},
+	{"Pull Up", []string{Back}, []string{Biceps}, Bodyweight, VerticalPull, false, []string{"Pullup", "Pull Ups", "Chin Up", "Chinup"}},
+	{"Lat Pulldown", []string{Back}, []string{Biceps}, Cable, VerticalPull, false, []string{"Pulldown", "Pull Down", "Wide Grip Pulldown"}},
+	{"Barbell Row", []string{Back}, []string{Biceps, RearDelts}, Barbell, HorizontalPull, false, []string{"Bent Over Row", "BB Row", "Pendlay Row"}},
+	{"Dumbbell Row", []string{Back}, []string{Biceps, RearDelts}, Dumbbell, HorizontalPull, true, []string{"DB Row", "One Arm Row", "Single Arm Dumbbell Row"}},
+	{"Seated Cable Row", []string{Back}, []string{Biceps, RearDelts}, Cable, HorizontalPull, false, []string{"Cable Row", "Seated Row"}},
+	{"Chest Supported Row", []string{Back}, []string{Biceps, RearDelts}, Machine, HorizontalPull, false, []string{"T Bar Row", "Machine Row"}},
+	{"Barbell Shrug", []string{Traps}, nil, Barbell, Isolation, false, []string{"Shrug", "Shrugs"}},
+	{"Barbell Curl", []string{Biceps}, []string{Forearms}, Barbell, Isolation, false, []string{"BB Curl", "Curl", "EZ Bar Curl"}},
+	{"Dumbbell Curl", []string{Biceps}, []string{Forearms}, Dumbbell, Isolation, false, []string{"DB Curl", "Bicep Curl", "Biceps Curl"}},
+	{"Hammer Curl", []string{Biceps, Forearms}, nil, Dumbbell, Isolation, false, []string{"DB Hammer Curl"}},
+	{"Cable Curl", []string{Biceps}, nil, Cable, Isolation, false, nil},
+	{"Triceps Pushdown", []string{Triceps}, nil, Cable, Isolation, false, []string{"Tricep Pushdown", "Rope Pushdown", "Pushdown"}},
+	{"Overhead Triceps Extension", []string{Triceps}, nil, Cable, Isolation, false, []string{"Overhead Tricep Extension", "Overhead Extension"}},
+	{"Skull Crusher", []string{Triceps}, nil, Barbell, Isolation, false, []string{"Skullcrusher", "Lying Triceps Extension"}},
+	{"Close Grip Bench Press", []string{Triceps}, []string{Chest, FrontDelts}, Barbell, HorizontalPush, false, []string{"CGBP", "Close Grip Bench"}},
+	{"Cable Crunch", []string{Abs}, nil, Cable, Core, false, []string{"Crunch", "Crunches"}},
+	{"Hanging Leg Raise", []string{Abs}, nil, Bodyweight, Core, false, []string{"Leg Raise", "Hanging Knee Raise"}},
+	{"Plank", []string{Abs}, nil, Bodyweight, Core, false, nil},
+}
+
+// ID is the UUID a global exercise is seeded with
+func ID(name string) string {
+	return uuid.NewSHA1(namespace, []byte(strings.ToLower(name))).String()
+}
+
+// Seeded reports whether id is the UUID of an exercise of the catalog, these
+// are reset to match it on every start up
+func Seeded(id string) bool {
+	for _, e := range entries {
+		if ID(e.name) == id {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Exercises returns the global catalog
+func Exercises() []models.Exercise {
+	exercises := make([]models.Exercise, 0, len(entries))
+	for _, e := range entries {
+		exercises = append(exercises, models.Exercise{
+			UUID:             ID(e.name),
+			Name:             e.name,
+			PrimaryMuscles:   e.primary,
+			SecondaryMuscles: append([]string{}, e.secondary...),
+			Equipment:        e.equipment,
+			Movement:         e.movement,
+			Unilateral:       e.unilateral,
+			Aliases:          append([]string{}, e.aliases...),
+		})
+	}
+
+	return exercises
+}
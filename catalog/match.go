@@ -0,0 +1,125 @@
+package catalog
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/rekram1-node/workout-backend/models"
+)
+
+// MinScore is how similar a name has to be to a catalog entry, between 0 and
+// 1, to be matched onto it
+const MinScore = 0.8
+
+// abbreviations are expanded before names are compared
+var abbreviations = map[string]string{
+	"db":       "dumbbell",
+	"dumbell":  "dumbbell",
+	"dumbells": "dumbbell",
+	"bb":       "barbell",
+	"kb":       "kettlebell",
+	"ohp":      "overhead press",
+	"rdl":      "romanian deadlift",
+	"sldl":     "stiff leg deadlift",
+	"ext":      "extension",
+	"tri":      "triceps",
+	"tricep":   "triceps",
+	"bicep":    "biceps",
+}
+
+// Normalize lower cases a name, drops punctuation, expands abbreviations and
+// plurals so that e.g. "DB Bench-Press" and "dumbbell bench press" compare
+// equal
+func Normalize(name string) string {
+	fields := strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	words := make([]string, 0, len(fields))
+	for _, field := range fields {
+		if expanded, ok := abbreviations[field]; ok {
+			field = expanded
+		} else if len(field) > 3 && strings.HasSuffix(field, "s") && !strings.HasSuffix(field, "ss") {
+			field = strings.TrimSuffix(field, "s")
+		}
+		words = append(words, field)
+	}
+
+	return strings.Join(words, " ")
+}
+
+// Match finds the exercise name refers to. It returns nil when nothing scores
+// at least MinScore.
+func Match(name string, exercises []models.Exercise) (*models.Exercise, float64) {
+	normalized := Normalize(name)
+	if normalized == "" {
+		return nil, 0
+	}
+
+	var best *models.Exercise
+	var bestScore float64
+	for i := range exercises {
+		for _, candidate := range append([]string{exercises[i].Name}, exercises[i].Aliases...) {
+			score := similarity(normalized, Normalize(candidate))
+			if score > bestScore {
+				best, bestScore = &exercises[i], score
+			}
+		}
+	}
+	if bestScore < MinScore {
+		return nil, bestScore
+	}
+
+	return best, bestScore
+}
+
+// similarity is 1 minus the edit distance relative to the longer string
+func similarity(a, b string) float64 {
+	if a == b {
+		return 1
+	}
+
+	ra, rb := []rune(a), []rune(b)
+	longest := len(ra)
+	if len(rb) > longest {
+		longest = len(rb)
+	}
+	if longest == 0 {
+		return 0
+	}
+
+	return 1 - float64(levenshtein(ra, rb))/float64(longest)
+}
+
+func levenshtein(a, b []rune) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+
+	return prev[len(b)]
+}
+
+func min(values ...int) int {
+	m := values[0]
+	for _, v := range values[1:] {
+		if v < m {
+			m = v
+		}
+	}
+
+	return m
+}
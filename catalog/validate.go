@@ -0,0 +1,38 @@
+package catalog
+
+import "github.com/go-playground/validator/v10"
+
+// IsMuscle reports whether name is one of Muscles
+func IsMuscle(name string) bool {
+	return contains(Muscles, name)
+}
+
+// RegisterValidations adds the muscle, equipment and movement tags to v, they
+// accept a name from Muscles, EquipmentTypes and Movements
+func RegisterValidations(v *validator.Validate) error {
+	for tag, names := range map[string][]string{
+		"muscle":    Muscles,
+		"equipment": EquipmentTypes,
+		"movement":  Movements,
+	} {
+		names := names
+		err := v.RegisterValidation(tag, func(fl validator.FieldLevel) bool {
+			return contains(names, fl.Field().String())
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func contains(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+
+	return false
+}
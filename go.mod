@@ -10,6 +10,7 @@ require (
 	github.com/google/uuid v1.3.0
 	github.com/rekram1-node/httptemplate v1.1.0
 	github.com/rs/zerolog v1.29.0
+	golang.org/x/crypto v0.7.0
 	gorm.io/driver/postgres v1.5.0
 	gorm.io/gorm v1.24.7-0.20230306060331-85eaf9eeda11
 )
@@ -31,7 +32,6 @@ require (
 	github.com/mattn/go-isatty v0.0.18 // indirect
 	github.com/pkg/errors v0.9.1 // indirect
 	github.com/rs/xid v1.4.0 // indirect
-	golang.org/x/crypto v0.7.0 // indirect
 	golang.org/x/sys v0.6.0 // indirect
 	golang.org/x/text v0.8.0 // indirect
 )
@@ -0,0 +1,349 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/rekram1-node/workout-backend/auth"
+	"github.com/rekram1-node/workout-backend/models"
+	"github.com/rekram1-node/workout-backend/notify"
+	"github.com/rekram1-node/workout-backend/repository"
+	"github.com/rs/zerolog"
+)
+
+type AdminRepository interface {
+	SearchUsers(ctx context.Context, query repository.AdminUserQuery) (*repository.AdminUserPage, error)
+	ReadUser(ctx context.Context, uuid string) (*models.User, error)
+	ReadUserStats(ctx context.Context, userUUID string) (*repository.AdminUserStats, error)
+	SuspendUser(ctx context.Context, userUUID, reason string) error
+	UnsuspendUser(ctx context.Context, userUUID string) error
+	RequirePasswordReset(ctx context.Context, userUUID string) (*models.User, error)
+	RestoreUser(ctx context.Context, userUUID string) error
+	SetUserRole(ctx context.Context, userUUID, role string) error
+	RecordAuditEvent(ctx context.Context, event *models.AuditEvent) error
+}
+
+type adminReasonRequest struct {
+	Reason string `json:"reason" validate:"required,max=256"`
+}
+
+type adminRoleRequest struct {
+	Role string `json:"role" validate:"required,oneof=user coach admin"`
+}
+
+// audit records an admin action against the user in the id URL parameter
+func audit(r *http.Request, repo AdminRepository, principal *auth.Principal, action, detail string) error {
+	return repo.RecordAuditEvent(r.Context(), &models.AuditEvent{
+		ActorUUID:  principal.UserUUID,
+		TargetUUID: chi.URLParam(r, "id"),
+		Action:     action,
+		Detail:     detail,
+		IP:         clientIP(r),
+	})
+}
+
+func AdminUsersSearch(repo AdminRepository) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		params := r.URL.Query()
+		query := repository.AdminUserQuery{
+			Query:  params.Get("q"),
+			Status: params.Get("status"),
+		}
+		switch query.Status {
+		case "", repository.UserStatusActive, repository.UserStatusSuspended, repository.UserStatusDeleted:
+		default:
+			writeResponse(w, http.StatusBadRequest, map[string]string{
+				"error": "status must be one of active, suspended or deleted",
+			})
+			return
+		}
+
+		for name, dst := range map[string]*int{"page": &query.Page, "per_page": &query.PerPage} {
+			value := params.Get(name)
+			if value == "" {
+				continue
+			}
+			n, err := strconv.Atoi(value)
+			if err != nil || n <= 0 {
+				writeResponse(w, http.StatusBadRequest, map[string]string{
+					"error": "invalid " + name,
+				})
+				return
+			}
+			*dst = n
+		}
+
+		page, err := repo.SearchUsers(ctx, query)
+		if err != nil {
+			writeResponse(w, http.StatusInternalServerError, map[string]string{
+				"error": "failed to search users",
+			})
+			return
+		}
+
+		writeResponse(w, http.StatusOK, page)
+	}
+}
+
+func AdminUserRead(repo AdminRepository) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userUUID := chi.URLParam(r, "id")
+		stats, err := repo.ReadUserStats(r.Context(), userUUID)
+		if err != nil {
+			writeResponse(w, http.StatusNotFound, map[string]string{
+				"error": "no user found with id: " + userUUID,
+			})
+			return
+		}
+
+		writeResponse(w, http.StatusOK, stats)
+	}
+}
+
+// AdminUserSuspend blocks sign in for the user and signs them out everywhere
+func AdminUserSuspend(repo AdminRepository, revoker TokenRevoker) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		logger := zerolog.Ctx(ctx)
+		principal, ok := requirePrincipal(w, r)
+		if !ok {
+			return
+		}
+
+		var reasonReq adminReasonRequest
+		if !decodeRequest(w, r, &reasonReq) {
+			return
+		}
+
+		userUUID := chi.URLParam(r, "id")
+		if userUUID == principal.UserUUID {
+			writeResponse(w, http.StatusBadRequest, map[string]string{"error": "admins can't suspend themselves"})
+			return
+		}
+
+		if err := repo.SuspendUser(ctx, userUUID, reasonReq.Reason); err != nil {
+			writeResponse(w, http.StatusNotFound, map[string]string{
+				"error": "no user found with id: " + userUUID,
+			})
+			return
+		}
+		if err := audit(r, repo, principal, repository.AuditSuspend, reasonReq.Reason); err != nil {
+			logger.Error().Err(err).Str("user", userUUID).Msg("failed to audit suspension")
+		}
+
+		if err := revoker.RevokeAllTokens(ctx, userUUID); err != nil {
+			logger.Error().Err(err).Str("user", userUUID).Msg("failed to sign out suspended user")
+			writeResponse(w, http.StatusInternalServerError, map[string]string{
+				"error": "user suspended but could not be signed out",
+			})
+			return
+		}
+
+		writeResponse(w, http.StatusOK, map[string]string{
+			"message": "successfully suspended user: " + userUUID,
+		})
+	}
+}
+
+func AdminUserUnsuspend(repo AdminRepository) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		logger := zerolog.Ctx(ctx)
+		principal, ok := requirePrincipal(w, r)
+		if !ok {
+			return
+		}
+
+		userUUID := chi.URLParam(r, "id")
+		if err := repo.UnsuspendUser(ctx, userUUID); err != nil {
+			writeResponse(w, http.StatusNotFound, map[string]string{
+				"error": "no user found with id: " + userUUID,
+			})
+			return
+		}
+		if err := audit(r, repo, principal, repository.AuditUnsuspend, ""); err != nil {
+			logger.Error().Err(err).Str("user", userUUID).Msg("failed to audit unsuspension")
+		}
+
+		writeResponse(w, http.StatusOK, map[string]string{
+			"message": "successfully unsuspended user: " + userUUID,
+		})
+	}
+}
+
+// AdminUserPasswordReset signs the user out, refuses their current password
+// and sends them a reset code.
+func AdminUserPasswordReset(repo AdminRepository, passwords PasswordRepository, revoker TokenRevoker, notifier notify.Notifier, ttl time.Duration) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		logger := zerolog.Ctx(ctx)
+		principal, ok := requirePrincipal(w, r)
+		if !ok {
+			return
+		}
+
+		userUUID := chi.URLParam(r, "id")
+		user, err := repo.RequirePasswordReset(ctx, userUUID)
+		if err != nil {
+			writeResponse(w, http.StatusNotFound, map[string]string{
+				"error": "no user found with id: " + userUUID,
+			})
+			return
+		}
+		if err := audit(r, repo, principal, repository.AuditPasswordReset, ""); err != nil {
+			logger.Error().Err(err).Str("user", userUUID).Msg("failed to audit forced password reset")
+		}
+
+		if err := revoker.RevokeAllTokens(ctx, userUUID); err != nil {
+			logger.Error().Err(err).Str("user", userUUID).Msg("failed to sign out user for password reset")
+		}
+
+		token, tokenHash, err := auth.CreateOpaqueToken()
+		if err == nil {
+			_, err = passwords.CreatePasswordReset(ctx, user.Username, tokenHash, time.Now().Add(ttl))
+		}
+		if err == nil {
+			err = notifier.Notify(ctx, passwordResetMessage(user, token, ttl))
+		}
+		if err != nil {
+			logger.Error().Err(err).Str("user", userUUID).Msg("failed to send forced password reset")
+			writeResponse(w, http.StatusInternalServerError, map[string]string{
+				"error": "password reset required but the reset code could not be sent, the user can still use forgot password",
+			})
+			return
+		}
+
+		writeResponse(w, http.StatusOK, map[string]string{
+			"message": "password reset required, a reset code has been sent to user: " + userUUID,
+		})
+	}
+}
+
+func AdminUserRestore(repo AdminRepository) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		logger := zerolog.Ctx(ctx)
+		principal, ok := requirePrincipal(w, r)
+		if !ok {
+			return
+		}
+
+		userUUID := chi.URLParam(r, "id")
+		err := repo.RestoreUser(ctx, userUUID)
+		switch {
+		case errors.Is(err, repository.ErrUserNotDeleted):
+			writeResponse(w, http.StatusConflict, map[string]string{"error": err.Error()})
+			return
+		case err != nil:
+			writeResponse(w, http.StatusNotFound, map[string]string{
+				"error": "no user found with id: " + userUUID,
+			})
+			return
+		}
+		if err := audit(r, repo, principal, repository.AuditRestore, ""); err != nil {
+			logger.Error().Err(err).Str("user", userUUID).Msg("failed to audit restore")
+		}
+
+		writeResponse(w, http.StatusOK, map[string]string{
+			"message": "successfully restored user: " + userUUID,
+		})
+	}
+}
+
+// AdminUserRole changes the role of a user. The user is signed out so the new
+// role applies straight away.
+func AdminUserRole(repo AdminRepository, revoker TokenRevoker) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		logger := zerolog.Ctx(ctx)
+		principal, ok := requirePrincipal(w, r)
+		if !ok {
+			return
+		}
+
+		var roleReq adminRoleRequest
+		if !decodeRequest(w, r, &roleReq) {
+			return
+		}
+
+		userUUID := chi.URLParam(r, "id")
+		if userUUID == principal.UserUUID {
+			writeResponse(w, http.StatusBadRequest, map[string]string{"error": "admins can't change their own role"})
+			return
+		}
+
+		if err := repo.SetUserRole(ctx, userUUID, roleReq.Role); err != nil {
+			writeResponse(w, http.StatusNotFound, map[string]string{
+				"error": "no user found with id: " + userUUID,
+			})
+			return
+		}
+		if err := audit(r, repo, principal, repository.AuditRoleChange, roleReq.Role); err != nil {
+			logger.Error().Err(err).Str("user", userUUID).Msg("failed to audit role change")
+		}
+
+		if err := revoker.RevokeAllTokens(ctx, userUUID); err != nil {
+			logger.Error().Err(err).Str("user", userUUID).Msg("failed to sign out user after role change")
+		}
+
+		writeResponse(w, http.StatusOK, map[string]string{
+			"message": "successfully changed role of user: " + userUUID,
+		})
+	}
+}
+
+// AdminImpersonate hands out a short lived access token to act as a user. It
+// is only issued once the impersonation has been audited.
+func AdminImpersonate(repo AdminRepository, keyring *auth.Keyring, ttl time.Duration) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		logger := zerolog.Ctx(ctx)
+		principal, ok := requirePrincipal(w, r)
+		if !ok {
+			return
+		}
+
+		var reasonReq adminReasonRequest
+		if !decodeRequest(w, r, &reasonReq) {
+			return
+		}
+
+		userUUID := chi.URLParam(r, "id")
+		user, err := repo.ReadUser(ctx, userUUID)
+		if err != nil {
+			writeResponse(w, http.StatusNotFound, map[string]string{
+				"error": "no user found with id: " + userUUID,
+			})
+			return
+		}
+		if user.Role == auth.RoleAdmin || user.SuspendedAt != nil {
+			writeResponse(w, http.StatusForbidden, map[string]string{
+				"error": "admins and suspended users can't be impersonated",
+			})
+			return
+		}
+
+		token, tokenID, err := auth.CreateImpersonationToken(user, principal.UserUUID, ttl, keyring)
+		if err != nil {
+			logger.Error().Err(err).Msg("failed to create impersonation token")
+			writeResponse(w, http.StatusInternalServerError, map[string]string{"error": "failed to create token"})
+			return
+		}
+
+		if err := audit(r, repo, principal, repository.AuditImpersonate, "token "+tokenID+": "+reasonReq.Reason); err != nil {
+			writeResponse(w, http.StatusInternalServerError, map[string]string{"error": "failed to create token"})
+			return
+		}
+
+		logger.Info().Str("user", userUUID).Str("token_id", tokenID).Msg("issued impersonation token")
+		writeResponse(w, http.StatusOK, map[string]interface{}{
+			"token":      token,
+			"expires_in": int(ttl.Seconds()),
+		})
+	}
+}
@@ -0,0 +1,309 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/rekram1-node/workout-backend/catalog"
+	"github.com/rekram1-node/workout-backend/models"
+	"github.com/rekram1-node/workout-backend/repository"
+	"github.com/rs/zerolog"
+)
+
+type ExerciseRepository interface {
+	ReadExercises(ctx context.Context, userUUID string, query repository.ExerciseQuery) ([]models.Exercise, error)
+	ReadExercise(ctx context.Context, userUUID, exerciseUUID string) (*models.Exercise, error)
+	CreateExercise(ctx context.Context, req *repository.ExerciseRequest) (*models.Exercise, error)
+	UpdateExercise(ctx context.Context, exerciseUUID string, req *repository.ExerciseRequest) (*models.Exercise, error)
+	DeleteExercise(ctx context.Context, userUUID, exerciseUUID string) error
+	CreateGlobalExercise(ctx context.Context, req *repository.ExerciseRequest) (*models.Exercise, error)
+	UpdateGlobalExercise(ctx context.Context, exerciseUUID string, req *repository.ExerciseRequest) (*models.Exercise, error)
+	ReadExerciseHistory(ctx context.Context, query repository.ExerciseHistoryQuery) (*repository.ExerciseHistoryResponse, error)
+}
+
+// decodeExerciseRequest decodes and validates the body, answering 400 itself
+// when it can't
+func decodeExerciseRequest(w http.ResponseWriter, r *http.Request, userUUID string) (*repository.ExerciseRequest, bool) {
+	var req repository.ExerciseRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		zerolog.Ctx(r.Context()).Warn().Err(err).Msg("failed to unmarshal body request")
+		writeResponse(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return nil, false
+	}
+	req.UserUUID = userUUID
+	if err := validateRequest(req); err != nil {
+		writeResponse(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return nil, false
+	}
+
+	return &req, true
+}
+
+// ExercisesRead lists the global catalog along with the custom exercises of
+// the user, filtered by the q, muscle and equipment query parameters.
+func ExercisesRead(repo ExerciseRepository) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		principal, ok := requirePrincipal(w, r)
+		if !ok {
+			return
+		}
+
+		params := r.URL.Query()
+		if muscle := params.Get("muscle"); muscle != "" && !catalog.IsMuscle(muscle) {
+			writeResponse(w, http.StatusBadRequest, map[string]string{"error": "unknown muscle: " + muscle})
+			return
+		}
+		exercises, err := repo.ReadExercises(ctx, principal.UserUUID, repository.ExerciseQuery{
+			Query:     params.Get("q"),
+			Muscle:    params.Get("muscle"),
+			Equipment: params.Get("equipment"),
+		})
+		if err != nil {
+			writeResponse(w, http.StatusInternalServerError, map[string]string{
+				"error": "failed to read exercises",
+			})
+			return
+		}
+
+		writeResponse(w, http.StatusOK, exercises)
+	}
+}
+
+func ExerciseRead(repo ExerciseRepository) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		principal, ok := requirePrincipal(w, r)
+		if !ok {
+			return
+		}
+
+		exerciseUUID := chi.URLParam(r, "id")
+		exercise, err := repo.ReadExercise(ctx, principal.UserUUID, exerciseUUID)
+		if err != nil {
+			writeResponse(w, http.StatusNotFound, map[string]string{
+				"error": "no exercise found with id: " + exerciseUUID,
+			})
+			return
+		}
+
+		writeResponse(w, http.StatusOK, exercise)
+	}
+}
+
+func ExerciseCreate(repo ExerciseRepository) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		logger := zerolog.Ctx(ctx)
+		principal, ok := requirePrincipal(w, r)
+		if !ok {
+			return
+		}
+
+		req, ok := decodeExerciseRequest(w, r, principal.UserUUID)
+		if !ok {
+			return
+		}
+
+		exercise, err := repo.CreateExercise(ctx, req)
+		if err != nil {
+			writeResponse(w, http.StatusInternalServerError, map[string]string{
+				"error": "failed to create exercise",
+			})
+			return
+		}
+
+		logger.Info().Str("exercise", exercise.UUID).Msg("created custom exercise")
+		writeResponse(w, http.StatusCreated, exercise)
+	}
+}
+
+// ExerciseUpdate replaces a custom exercise, global exercises can't be
+// changed and answer 404 like any exercise that isn't the user's.
+func ExerciseUpdate(repo ExerciseRepository) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		principal, ok := requirePrincipal(w, r)
+		if !ok {
+			return
+		}
+
+		req, ok := decodeExerciseRequest(w, r, principal.UserUUID)
+		if !ok {
+			return
+		}
+
+		exerciseUUID := chi.URLParam(r, "id")
+		exercise, err := repo.UpdateExercise(ctx, exerciseUUID, req)
+		if err != nil {
+			writeResponse(w, http.StatusNotFound, map[string]string{
+				"error": "no custom exercise found with id: " + exerciseUUID,
+			})
+			return
+		}
+
+		writeResponse(w, http.StatusOK, exercise)
+	}
+}
+
+func ExerciseDelete(repo ExerciseRepository) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		principal, ok := requirePrincipal(w, r)
+		if !ok {
+			return
+		}
+
+		exerciseUUID := chi.URLParam(r, "id")
+		if err := repo.DeleteExercise(ctx, principal.UserUUID, exerciseUUID); err != nil {
+			writeResponse(w, http.StatusNotFound, map[string]string{
+				"error": "no custom exercise found with id: " + exerciseUUID,
+			})
+			return
+		}
+
+		writeResponse(w, http.StatusOK, map[string]string{
+			"message": "successfully deleted exercise: " + exerciseUUID,
+		})
+	}
+}
+
+// GlobalExerciseCreate adds an exercise to the global catalog, it is only
+// routed for coaches and admins
+func GlobalExerciseCreate(repo ExerciseRepository) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		logger := zerolog.Ctx(ctx)
+		principal, ok := requirePrincipal(w, r)
+		if !ok {
+			return
+		}
+
+		req, ok := decodeExerciseRequest(w, r, principal.UserUUID)
+		if !ok {
+			return
+		}
+
+		exercise, err := repo.CreateGlobalExercise(ctx, req)
+		if err != nil {
+			writeResponse(w, http.StatusInternalServerError, map[string]string{
+				"error": "failed to create exercise",
+			})
+			return
+		}
+
+		logger.Info().Str("exercise", exercise.UUID).Msg("created global exercise")
+		writeResponse(w, http.StatusCreated, exercise)
+	}
+}
+
+// GlobalExerciseUpdate replaces a global exercise a coach or admin added,
+// seeded exercises answer 404
+func GlobalExerciseUpdate(repo ExerciseRepository) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		principal, ok := requirePrincipal(w, r)
+		if !ok {
+			return
+		}
+
+		req, ok := decodeExerciseRequest(w, r, principal.UserUUID)
+		if !ok {
+			return
+		}
+
+		exerciseUUID := chi.URLParam(r, "id")
+		exercise, err := repo.UpdateGlobalExercise(ctx, exerciseUUID, req)
+		if err != nil {
+			writeResponse(w, http.StatusNotFound, map[string]string{
+				"error": "no added global exercise found with id: " + exerciseUUID,
+			})
+			return
+		}
+
+		writeResponse(w, http.StatusOK, exercise)
+	}
+}
+
+// parseDate reads a query parameter as an RFC 3339 time or a date, a date
+// given as the end of a range covers the whole day
+func parseDate(value string, end bool) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+
+	t, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if end {
+		t = t.AddDate(0, 0, 1).Add(-time.Nanosecond)
+	}
+
+	return t, nil
+}
+
+// ExerciseHistory responds with the logged sessions of an exercise across
+// every meso, newest first, and a time series of them for charting. The
+// from and to query parameters limit the date range, limit and cursor page
+// through the sessions.
+func ExerciseHistory(repo ExerciseRepository) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		principal, ok := requirePrincipal(w, r)
+		if !ok {
+			return
+		}
+
+		params := r.URL.Query()
+		query := repository.ExerciseHistoryQuery{
+			UserUUID:   principal.UserUUID,
+			ExerciseID: chi.URLParam(r, "id"),
+			Cursor:     params.Get("cursor"),
+		}
+		var err error
+		if query.From, err = parseDate(params.Get("from"), false); err != nil {
+			writeResponse(w, http.StatusBadRequest, map[string]string{"error": "invalid from date"})
+			return
+		}
+		if query.To, err = parseDate(params.Get("to"), true); err != nil {
+			writeResponse(w, http.StatusBadRequest, map[string]string{"error": "invalid to date"})
+			return
+		}
+		if limit := params.Get("limit"); limit != "" {
+			if query.Limit, err = strconv.Atoi(limit); err != nil || query.Limit < 1 {
+				writeResponse(w, http.StatusBadRequest, map[string]string{"error": "invalid limit"})
+				return
+			}
+		}
+
+		if _, err := repo.ReadExercise(ctx, principal.UserUUID, query.ExerciseID); err != nil {
+			writeResponse(w, http.StatusNotFound, map[string]string{
+				"error": "no exercise found with id: " + query.ExerciseID,
+			})
+			return
+		}
+
+		history, err := repo.ReadExerciseHistory(ctx, query)
+		switch {
+		case errors.Is(err, repository.ErrInvalidCursor):
+			writeResponse(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		case err != nil:
+			writeResponse(w, http.StatusInternalServerError, map[string]string{
+				"error": "failed to read exercise history",
+			})
+			return
+		}
+
+		writeResponse(w, http.StatusOK, history)
+	}
+}
@@ -7,6 +7,9 @@ import (
 	"strings"
 
 	validator "github.com/go-playground/validator/v10"
+	"github.com/rekram1-node/workout-backend/auth"
+	"github.com/rekram1-node/workout-backend/catalog"
+	"github.com/rs/zerolog"
 )
 
 func writeResponse(w http.ResponseWriter, statusCode int, response any) {
@@ -14,10 +17,43 @@ func writeResponse(w http.ResponseWriter, statusCode int, response any) {
 	_ = json.NewEncoder(w).Encode(response)
 }
 
+// requirePrincipal returns the authenticated caller of the request. When there
+// is none it answers 401 itself, so handlers fail closed by returning.
+func requirePrincipal(w http.ResponseWriter, r *http.Request) (*auth.Principal, bool) {
+	principal, ok := auth.PrincipalFromContext(r.Context())
+	if !ok {
+		zerolog.Ctx(r.Context()).Error().Msg("no authenticated principal in request context")
+		writeResponse(w, http.StatusUnauthorized, map[string]string{
+			"error": "unauthenticated",
+		})
+		return nil, false
+	}
+
+	return principal, true
+}
+
+// decodeRequest decodes and validates the body into v, answering 400 itself
+// when it can't
+func decodeRequest(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		writeResponse(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return false
+	}
+	if err := validateRequest(v); err != nil {
+		writeResponse(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return false
+	}
+
+	return true
+}
+
 // At some point might want to add injection prevention
 // Or just sanitize the requests...
 func validateRequest(s interface{}) error {
 	validate := validator.New()
+	if err := catalog.RegisterValidations(validate); err != nil {
+		return err
+	}
 	err := validate.Struct(s)
 	if err == nil {
 		return nil
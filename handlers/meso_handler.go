@@ -2,13 +2,20 @@ package handlers
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
+	"mime"
 	"net/http"
 	"strconv"
+	"strings"
 
+	"github.com/rekram1-node/workout-backend/jsonpatch"
 	"github.com/rekram1-node/workout-backend/models"
+	"github.com/rekram1-node/workout-backend/progression"
 	"github.com/rekram1-node/workout-backend/repository"
 	"github.com/rs/zerolog"
 )
@@ -18,14 +25,21 @@ type MesoRepository interface {
 	ReadMeso(ctx context.Context, userUUID, mesoUUID string) (*repository.MesoResponse, error)
 	ReadxMesos(ctx context.Context, userUUID string, mesoCount int) (*[]repository.MesoResponse, error)
 	UpdateMeso(ctx context.Context, mesoUpdateReq *repository.MesoUpdateRequest) (*repository.MesoResponse, error)
-	DeleteMeso(ctx context.Context, userUUID, mesoUUID string) error
+	DeleteMeso(ctx context.Context, userUUID, mesoUUID string, version int) error
+	CompleteWeek(ctx context.Context, userUUID, mesoUUID string, version, number int) (*repository.MesoResponse, error)
+	ReadWeek(ctx context.Context, userUUID, mesoUUID string, number int) (*models.Week, error)
+	PatchMeso(ctx context.Context, userUUID, mesoUUID string, version int, apply func(doc, patch []byte) ([]byte, error), patch []byte) (*repository.MesoResponse, error)
 }
 
 func MesoCreate(repo MesoRepository) func(w http.ResponseWriter, r *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
 		ctx := r.Context()
 		logger := zerolog.Ctx(ctx)
-		userUUID := r.Header.Get("UUID")
+		principal, ok := requirePrincipal(w, r)
+		if !ok {
+			return
+		}
+		userUUID := principal.UserUUID
 		var newMesoReq *repository.MesoCreateRequest
 
 		err := json.NewDecoder(r.Body).Decode(&newMesoReq)
@@ -48,6 +62,10 @@ func MesoCreate(repo MesoRepository) func(w http.ResponseWriter, r *http.Request
 		}
 
 		meso, err := repo.CreateMeso(ctx, newMesoReq)
+		if errors.Is(err, repository.ErrUnknownExercise) {
+			writeResponse(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
 		if err != nil {
 			logger.Warn().Err(err).Msg("failed to create user")
 			writeResponse(w, http.StatusInternalServerError, map[string]string{
@@ -57,6 +75,7 @@ func MesoCreate(repo MesoRepository) func(w http.ResponseWriter, r *http.Request
 		}
 
 		logger.Info().Str("mesoUUID", meso.UUID).Msg("successfully created new meso")
+		w.Header().Set("ETag", mesoETag(meso.Version))
 		writeResponse(w, http.StatusOK, meso)
 	}
 }
@@ -65,7 +84,11 @@ func MesoRead(repo MesoRepository) func(w http.ResponseWriter, r *http.Request)
 	return func(w http.ResponseWriter, r *http.Request) {
 		ctx := r.Context()
 		logger := zerolog.Ctx(ctx)
-		userUUID := r.Header.Get("UUID")
+		principal, ok := requirePrincipal(w, r)
+		if !ok {
+			return
+		}
+		userUUID := principal.UserUUID
 		mesoUUID := r.URL.Query().Get("mesoUUID")
 		if mesoUUID == "" {
 			writeResponse(w, http.StatusBadRequest, map[string]string{
@@ -82,6 +105,9 @@ func MesoRead(repo MesoRepository) func(w http.ResponseWriter, r *http.Request)
 			})
 			return
 		}
+		if notModified(w, r, mesoETag(meso.Version)) {
+			return
+		}
 
 		writeResponse(w, http.StatusOK, meso)
 	}
@@ -91,7 +117,11 @@ func MesosRead(repo MesoRepository) func(w http.ResponseWriter, r *http.Request)
 	return func(w http.ResponseWriter, r *http.Request) {
 		ctx := r.Context()
 		logger := zerolog.Ctx(ctx)
-		userUUID := r.Header.Get("UUID")
+		principal, ok := requirePrincipal(w, r)
+		if !ok {
+			return
+		}
+		userUUID := principal.UserUUID
 		numMesos, err := strconv.Atoi(r.URL.Query().Get("count"))
 		if err != nil || numMesos <= 0 {
 			writeResponse(w, http.StatusBadRequest, map[string]string{
@@ -107,16 +137,25 @@ func MesosRead(repo MesoRepository) func(w http.ResponseWriter, r *http.Request)
 			})
 			return
 		}
+		if notModified(w, r, mesosETag(*mesos)) {
+			return
+		}
 
 		writeResponse(w, http.StatusOK, mesos)
 	}
 }
 
+// UpdateMeso changes the name and weeks of a meso, or applies a JSON Merge
+// Patch or JSON Patch to it when the body is one
 func UpdateMeso(repo MesoRepository) func(w http.ResponseWriter, r *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
 		ctx := r.Context()
 		logger := zerolog.Ctx(ctx)
-		userUUID := r.Header.Get("UUID")
+		principal, ok := requirePrincipal(w, r)
+		if !ok {
+			return
+		}
+		userUUID := principal.UserUUID
 		mesoUUID := r.URL.Query().Get("mesoUUID")
 		if mesoUUID == "" {
 			writeResponse(w, http.StatusBadRequest, map[string]string{
@@ -125,6 +164,44 @@ func UpdateMeso(repo MesoRepository) func(w http.ResponseWriter, r *http.Request
 			return
 		}
 
+		version, ok := ifMatch(w, r, repo, userUUID, mesoUUID)
+		if !ok {
+			return
+		}
+
+		// a patch document is applied to the meso as it is now, anything else
+		// replaces the name and weeks it has
+		mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		var apply func(doc, patch []byte) ([]byte, error)
+		switch mediaType {
+		case jsonpatch.MergePatchType:
+			apply = jsonpatch.MergePatch
+		case jsonpatch.JSONPatchType:
+			apply = jsonpatch.Apply
+		}
+		if apply == nil && r.Method == http.MethodPatch {
+			w.Header().Set("Accept-Patch", jsonpatch.MergePatchType+", "+jsonpatch.JSONPatchType)
+			writeResponse(w, http.StatusUnsupportedMediaType, map[string]string{
+				"error": "patch must be " + jsonpatch.MergePatchType + " or " + jsonpatch.JSONPatchType,
+			})
+			return
+		}
+		if apply != nil {
+			patch, err := io.ReadAll(r.Body)
+			if err != nil || len(patch) == 0 {
+				writeResponse(w, http.StatusBadRequest, map[string]string{"error": "invalid request: empty request body"})
+				return
+			}
+			meso, err := repo.PatchMeso(ctx, userUUID, mesoUUID, version, apply, patch)
+			if err != nil {
+				writeMesoEditError(w, r, repo, userUUID, mesoUUID, err)
+				return
+			}
+			w.Header().Set("ETag", mesoETag(meso.Version))
+			writeResponse(w, http.StatusOK, meso)
+			return
+		}
+
 		var newMesoReq *repository.MesoUpdateRequest
 
 		err := json.NewDecoder(r.Body).Decode(&newMesoReq)
@@ -140,6 +217,7 @@ func UpdateMeso(repo MesoRepository) func(w http.ResponseWriter, r *http.Request
 
 		newMesoReq.UserUUID = userUUID
 		newMesoReq.MesoUUID = mesoUUID
+		newMesoReq.Version = version
 		if err := validateRequest(newMesoReq); err != nil {
 			writeResponse(w, http.StatusBadRequest, map[string]string{
 				"error": err.Error(),
@@ -149,12 +227,10 @@ func UpdateMeso(repo MesoRepository) func(w http.ResponseWriter, r *http.Request
 
 		meso, err := repo.UpdateMeso(ctx, newMesoReq)
 		if err != nil {
-			logger.Error().Err(err).Msg("failed to update meso")
-			writeResponse(w, http.StatusInternalServerError, map[string]string{
-				"error": err.Error(),
-			})
+			writeMesoEditError(w, r, repo, userUUID, mesoUUID, err)
 			return
 		}
+		w.Header().Set("ETag", mesoETag(meso.Version))
 
 		writeResponse(w, http.StatusOK, meso)
 	}
@@ -164,7 +240,11 @@ func DeleteMeso(repo MesoRepository) func(w http.ResponseWriter, r *http.Request
 	return func(w http.ResponseWriter, r *http.Request) {
 		ctx := r.Context()
 		logger := zerolog.Ctx(ctx)
-		userUUID := r.Header.Get("UUID")
+		principal, ok := requirePrincipal(w, r)
+		if !ok {
+			return
+		}
+		userUUID := principal.UserUUID
 		mesoUUID := r.URL.Query().Get("mesoUUID")
 		if mesoUUID == "" {
 			writeResponse(w, http.StatusBadRequest, map[string]string{
@@ -173,7 +253,17 @@ func DeleteMeso(repo MesoRepository) func(w http.ResponseWriter, r *http.Request
 			return
 		}
 
-		if err := repo.DeleteMeso(ctx, userUUID, mesoUUID); err != nil {
+		version, ok := ifMatch(w, r, repo, userUUID, mesoUUID)
+		if !ok {
+			return
+		}
+
+		err := repo.DeleteMeso(ctx, userUUID, mesoUUID, version)
+		if errors.Is(err, repository.ErrVersionMismatch) {
+			writeStaleMeso(w, r, repo, userUUID, mesoUUID)
+			return
+		}
+		if err != nil {
 			logger.Error().Err(err).Msg("failed to delete meso")
 			writeResponse(w, http.StatusNotFound, map[string]string{
 				"error": err.Error(),
@@ -186,3 +276,152 @@ func DeleteMeso(repo MesoRepository) func(w http.ResponseWriter, r *http.Request
 		})
 	}
 }
+
+// WeekComplete marks a week as done and fills in next week's targets
+func WeekComplete(repo MesoRepository) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		principal, ok := requirePrincipal(w, r)
+		if !ok {
+			return
+		}
+		mesoUUID := r.URL.Query().Get("mesoUUID")
+		if mesoUUID == "" {
+			writeResponse(w, http.StatusBadRequest, map[string]string{
+				"error": "missing mesoUUID",
+			})
+			return
+		}
+		number, err := strconv.Atoi(r.URL.Query().Get("week"))
+		if err != nil || number <= 0 {
+			writeResponse(w, http.StatusBadRequest, map[string]string{
+				"error": "invalid week number",
+			})
+			return
+		}
+		version, ok := ifMatch(w, r, repo, principal.UserUUID, mesoUUID)
+		if !ok {
+			return
+		}
+
+		meso, err := repo.CompleteWeek(ctx, principal.UserUUID, mesoUUID, version, number)
+		if err != nil {
+			writeMesoEditError(w, r, repo, principal.UserUUID, mesoUUID, err)
+			return
+		}
+
+		w.Header().Set("ETag", mesoETag(meso.Version))
+		writeResponse(w, http.StatusOK, meso)
+	}
+}
+
+// WeekSuggestions lists load changes for lifts of a week whose logged RIR was
+// far from the target
+func WeekSuggestions(repo MesoRepository) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		logger := zerolog.Ctx(ctx)
+		principal, ok := requirePrincipal(w, r)
+		if !ok {
+			return
+		}
+		mesoUUID := r.URL.Query().Get("mesoUUID")
+		if mesoUUID == "" {
+			writeResponse(w, http.StatusBadRequest, map[string]string{
+				"error": "missing mesoUUID",
+			})
+			return
+		}
+		number, err := strconv.Atoi(r.URL.Query().Get("week"))
+		if err != nil || number <= 0 {
+			writeResponse(w, http.StatusBadRequest, map[string]string{
+				"error": "invalid week number",
+			})
+			return
+		}
+
+		week, err := repo.ReadWeek(ctx, principal.UserUUID, mesoUUID, number)
+		if err != nil {
+			logger.Error().Err(err).Msg("failed to find week")
+			writeResponse(w, http.StatusNotFound, map[string]string{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		writeResponse(w, http.StatusOK, progression.Suggestions(week))
+	}
+}
+
+// mesoETag is the ETag of a version of a meso
+func mesoETag(version int) string {
+	return `"` + strconv.Itoa(version) + `"`
+}
+
+// mesosETag is the ETag of a list of mesos, it changes when any of them does
+func mesosETag(mesos []repository.MesoResponse) string {
+	hash := sha256.New()
+	for _, meso := range mesos {
+		fmt.Fprintf(hash, "%s:%d;", meso.UUID, meso.Version)
+	}
+
+	return `"` + hex.EncodeToString(hash.Sum(nil))[:16] + `"`
+}
+
+// notModified sets the ETag of the response and answers 304 when it is one
+// the client already has in If-None-Match
+func notModified(w http.ResponseWriter, r *http.Request, etag string) bool {
+	w.Header().Set("ETag", etag)
+	for _, tag := range strings.Split(r.Header.Get("If-None-Match"), ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return true
+		}
+	}
+
+	return false
+}
+
+type mesoReader interface {
+	ReadMeso(ctx context.Context, userUUID, mesoUUID string) (*repository.MesoResponse, error)
+}
+
+// ifMatch reads the version of the meso a change was made against from
+// If-Match, 0 when any version will do. A missing header answers 428, a
+// header that can't match answers 412.
+func ifMatch(w http.ResponseWriter, r *http.Request, repo mesoReader, userUUID, mesoUUID string) (int, bool) {
+	match := strings.TrimSpace(r.Header.Get("If-Match"))
+	switch {
+	case match == "":
+		writeResponse(w, http.StatusPreconditionRequired, map[string]string{
+			"error": "If-Match with the ETag of the meso is required",
+		})
+		return 0, false
+	case match == "*":
+		return 0, true
+	}
+
+	if len(match) > 2 && match[0] == '"' && match[len(match)-1] == '"' {
+		if version, err := strconv.Atoi(match[1 : len(match)-1]); err == nil && version > 0 {
+			return version, true
+		}
+	}
+
+	writeStaleMeso(w, r, repo, userUUID, mesoUUID)
+	return 0, false
+}
+
+// writeStaleMeso answers 412 with the meso as it is now
+func writeStaleMeso(w http.ResponseWriter, r *http.Request, repo mesoReader, userUUID, mesoUUID string) {
+	meso, err := repo.ReadMeso(r.Context(), userUUID, mesoUUID)
+	if err != nil {
+		writeResponse(w, http.StatusNotFound, map[string]string{
+			"error": "no meso found with uuid: " + mesoUUID,
+		})
+		return
+	}
+
+	w.Header().Set("ETag", mesoETag(meso.Version))
+	writeResponse(w, http.StatusPreconditionFailed, meso)
+}
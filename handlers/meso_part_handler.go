@@ -0,0 +1,390 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi"
+	"github.com/rekram1-node/workout-backend/jsonpatch"
+	"github.com/rekram1-node/workout-backend/models"
+	"github.com/rekram1-node/workout-backend/progression"
+	"github.com/rekram1-node/workout-backend/repository"
+	"github.com/rs/zerolog"
+)
+
+type MesoPartRepository interface {
+	ReadWeek(ctx context.Context, userUUID, mesoUUID string, number int) (*models.Week, error)
+	ReadDay(ctx context.Context, userUUID, mesoUUID string, number int, weekday string) (*models.Day, error)
+	ReadLift(ctx context.Context, userUUID, mesoUUID string, number int, weekday string, index int) (*models.Lift, error)
+	ReadMeso(ctx context.Context, userUUID, mesoUUID string) (*repository.MesoResponse, error)
+	EditMeso(ctx context.Context, userUUID, mesoUUID string, version int, edit repository.MesoEdit) (*repository.MesoResponse, error)
+}
+
+// mesoPath is the part of a meso a request addresses, from the uuid, week,
+// day and lift URL parameters
+type mesoPath struct {
+	meso string
+	week int
+	day  string
+	lift int
+}
+
+// intParams reads the named URL parameters as non negative numbers,
+// answering 400 itself when one isn't
+func intParams(w http.ResponseWriter, r *http.Request, names ...string) ([]int, bool) {
+	values := make([]int, 0, len(names))
+	for _, name := range names {
+		value, err := strconv.Atoi(chi.URLParam(r, name))
+		if err != nil || value < 0 {
+			writeResponse(w, http.StatusBadRequest, map[string]string{
+				"error": "invalid " + name,
+			})
+			return nil, false
+		}
+		values = append(values, value)
+	}
+
+	return values, true
+}
+
+// readMesoPath reads the path of the request down to the day, and the lift
+// when withLift is set, answering 400 itself when it is invalid
+func readMesoPath(w http.ResponseWriter, r *http.Request, withDay, withLift bool) (*mesoPath, bool) {
+	names := []string{"week"}
+	if withLift {
+		names = append(names, "lift")
+	}
+	values, ok := intParams(w, r, names...)
+	if !ok {
+		return nil, false
+	}
+
+	path := &mesoPath{meso: chi.URLParam(r, "uuid"), week: values[0]}
+	if withLift {
+		path.lift = values[1]
+	}
+	if withDay {
+		path.day = chi.URLParam(r, "day")
+		valid := false
+		for _, weekday := range models.Weekdays {
+			valid = valid || weekday == path.day
+		}
+		if !valid {
+			writeResponse(w, http.StatusBadRequest, map[string]string{
+				"error": "invalid day, expected one of monday to sunday",
+			})
+			return nil, false
+		}
+	}
+
+	return path, true
+}
+
+// isMesoPathError reports whether err is the meso, or a week, day, lift or
+// set of it, not being found
+func isMesoPathError(err error) bool {
+	return errors.Is(err, repository.ErrMesoNotFound) ||
+		errors.Is(err, repository.ErrWeekNotFound) ||
+		errors.Is(err, repository.ErrDayNotFound) ||
+		errors.Is(err, repository.ErrLiftNotFound) ||
+		errors.Is(err, repository.ErrSetNotFound)
+}
+
+// writeMesoEditError answers a failed change to a meso
+func writeMesoEditError(w http.ResponseWriter, r *http.Request, repo mesoReader, userUUID, mesoUUID string, err error) {
+	switch {
+	case errors.Is(err, repository.ErrVersionMismatch):
+		writeStaleMeso(w, r, repo, userUUID, mesoUUID)
+	case isMesoPathError(err):
+		writeResponse(w, http.StatusNotFound, map[string]string{"error": err.Error()})
+	case errors.Is(err, jsonpatch.ErrTestFailed):
+		writeResponse(w, http.StatusConflict, map[string]string{"error": err.Error()})
+	case errors.Is(err, repository.ErrUnknownExercise),
+		errors.Is(err, repository.ErrInvalidPatch),
+		errors.Is(err, jsonpatch.ErrInvalidPatch),
+		errors.Is(err, jsonpatch.ErrInvalidPath),
+		errors.Is(err, repository.ErrInvalidOrder),
+		errors.Is(err, repository.ErrInvalidPosition),
+		errors.Is(err, progression.ErrUnknownRule):
+		writeResponse(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+	default:
+		zerolog.Ctx(r.Context()).Error().Err(err).Msg("failed to update meso")
+		writeResponse(w, http.StatusInternalServerError, map[string]string{
+			"error": "failed to update meso",
+		})
+	}
+}
+
+// editMesoPart answers with the meso after the edit that build makes from the
+// request, build answers itself when it can't make one
+func editMesoPart(repo MesoPartRepository, withDay, withLift bool, build func(w http.ResponseWriter, r *http.Request, path *mesoPath) (repository.MesoEdit, bool)) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		principal, ok := requirePrincipal(w, r)
+		if !ok {
+			return
+		}
+		path, ok := readMesoPath(w, r, withDay, withLift)
+		if !ok {
+			return
+		}
+		version, ok := ifMatch(w, r, repo, principal.UserUUID, path.meso)
+		if !ok {
+			return
+		}
+
+		edit, ok := build(w, r, path)
+		if !ok {
+			return
+		}
+
+		meso, err := repo.EditMeso(ctx, principal.UserUUID, path.meso, version, edit)
+		if err != nil {
+			writeMesoEditError(w, r, repo, principal.UserUUID, path.meso, err)
+			return
+		}
+
+		w.Header().Set("ETag", mesoETag(meso.Version))
+		writeResponse(w, http.StatusOK, meso)
+	}
+}
+
+// readPatch reads the body of a PATCH request, a JSON Merge Patch
+func readPatch(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	patch, err := io.ReadAll(r.Body)
+	if err != nil || !json.Valid(patch) {
+		writeResponse(w, http.StatusBadRequest, map[string]string{
+			"error": "invalid request: body must be a JSON object",
+		})
+		return nil, false
+	}
+
+	return patch, true
+}
+
+// atParam reads the optional at query parameter, where an insert goes
+func atParam(w http.ResponseWriter, r *http.Request) (int, bool) {
+	value := r.URL.Query().Get("at")
+	if value == "" {
+		return -1, true
+	}
+	at, err := strconv.Atoi(value)
+	if err != nil || at < 0 {
+		writeResponse(w, http.StatusBadRequest, map[string]string{"error": "invalid at"})
+		return 0, false
+	}
+
+	return at, true
+}
+
+func WeekRead(repo MesoPartRepository) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		principal, ok := requirePrincipal(w, r)
+		if !ok {
+			return
+		}
+		path, ok := readMesoPath(w, r, false, false)
+		if !ok {
+			return
+		}
+
+		week, err := repo.ReadWeek(r.Context(), principal.UserUUID, path.meso, path.week)
+		if err != nil {
+			writeResponse(w, http.StatusNotFound, map[string]string{"error": err.Error()})
+			return
+		}
+
+		writeResponse(w, http.StatusOK, week)
+	}
+}
+
+func WeekReplace(repo MesoPartRepository) func(w http.ResponseWriter, r *http.Request) {
+	return editMesoPart(repo, false, false, func(w http.ResponseWriter, r *http.Request, path *mesoPath) (repository.MesoEdit, bool) {
+		var week models.Week
+		if !decodeRequest(w, r, &week) {
+			return nil, false
+		}
+		return repository.ReplaceWeek(path.week, week), true
+	})
+}
+
+func WeekPatch(repo MesoPartRepository) func(w http.ResponseWriter, r *http.Request) {
+	return editMesoPart(repo, false, false, func(w http.ResponseWriter, r *http.Request, path *mesoPath) (repository.MesoEdit, bool) {
+		patch, ok := readPatch(w, r)
+		if !ok {
+			return nil, false
+		}
+		return repository.PatchWeek(path.week, patch), true
+	})
+}
+
+func WeekDelete(repo MesoPartRepository) func(w http.ResponseWriter, r *http.Request) {
+	return editMesoPart(repo, false, false, func(w http.ResponseWriter, r *http.Request, path *mesoPath) (repository.MesoEdit, bool) {
+		return repository.DeleteWeek(path.week), true
+	})
+}
+
+// WeekInsert adds a week to the meso at the index in the at query parameter,
+// it is appended without one
+func WeekInsert(repo MesoPartRepository) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		principal, ok := requirePrincipal(w, r)
+		if !ok {
+			return
+		}
+		mesoUUID := chi.URLParam(r, "uuid")
+		version, ok := ifMatch(w, r, repo, principal.UserUUID, mesoUUID)
+		if !ok {
+			return
+		}
+		at, ok := atParam(w, r)
+		if !ok {
+			return
+		}
+		var week models.Week
+		if !decodeRequest(w, r, &week) {
+			return
+		}
+
+		meso, err := repo.EditMeso(ctx, principal.UserUUID, mesoUUID, version, repository.InsertWeek(at, week))
+		if err != nil {
+			writeMesoEditError(w, r, repo, principal.UserUUID, mesoUUID, err)
+			return
+		}
+
+		w.Header().Set("ETag", mesoETag(meso.Version))
+		writeResponse(w, http.StatusOK, meso)
+	}
+}
+
+func DayRead(repo MesoPartRepository) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		principal, ok := requirePrincipal(w, r)
+		if !ok {
+			return
+		}
+		path, ok := readMesoPath(w, r, true, false)
+		if !ok {
+			return
+		}
+
+		day, err := repo.ReadDay(r.Context(), principal.UserUUID, path.meso, path.week, path.day)
+		if err != nil {
+			writeResponse(w, http.StatusNotFound, map[string]string{"error": err.Error()})
+			return
+		}
+
+		writeResponse(w, http.StatusOK, day)
+	}
+}
+
+func DayReplace(repo MesoPartRepository) func(w http.ResponseWriter, r *http.Request) {
+	return editMesoPart(repo, true, false, func(w http.ResponseWriter, r *http.Request, path *mesoPath) (repository.MesoEdit, bool) {
+		var day models.Day
+		if !decodeRequest(w, r, &day) {
+			return nil, false
+		}
+		return repository.ReplaceDay(path.week, path.day, day), true
+	})
+}
+
+func DayPatch(repo MesoPartRepository) func(w http.ResponseWriter, r *http.Request) {
+	return editMesoPart(repo, true, false, func(w http.ResponseWriter, r *http.Request, path *mesoPath) (repository.MesoEdit, bool) {
+		patch, ok := readPatch(w, r)
+		if !ok {
+			return nil, false
+		}
+		return repository.PatchDay(path.week, path.day, patch), true
+	})
+}
+
+// DayDelete turns the day into a rest day
+func DayDelete(repo MesoPartRepository) func(w http.ResponseWriter, r *http.Request) {
+	return editMesoPart(repo, true, false, func(w http.ResponseWriter, r *http.Request, path *mesoPath) (repository.MesoEdit, bool) {
+		return repository.ClearDay(path.week, path.day), true
+	})
+}
+
+func LiftRead(repo MesoPartRepository) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		principal, ok := requirePrincipal(w, r)
+		if !ok {
+			return
+		}
+		path, ok := readMesoPath(w, r, true, true)
+		if !ok {
+			return
+		}
+
+		lift, err := repo.ReadLift(r.Context(), principal.UserUUID, path.meso, path.week, path.day, path.lift)
+		if err != nil {
+			writeResponse(w, http.StatusNotFound, map[string]string{"error": err.Error()})
+			return
+		}
+
+		writeResponse(w, http.StatusOK, lift)
+	}
+}
+
+func LiftReplace(repo MesoPartRepository) func(w http.ResponseWriter, r *http.Request) {
+	return editMesoPart(repo, true, true, func(w http.ResponseWriter, r *http.Request, path *mesoPath) (repository.MesoEdit, bool) {
+		var lift models.Lift
+		if !decodeRequest(w, r, &lift) {
+			return nil, false
+		}
+		return repository.ReplaceLift(path.week, path.day, path.lift, lift), true
+	})
+}
+
+func LiftPatch(repo MesoPartRepository) func(w http.ResponseWriter, r *http.Request) {
+	return editMesoPart(repo, true, true, func(w http.ResponseWriter, r *http.Request, path *mesoPath) (repository.MesoEdit, bool) {
+		patch, ok := readPatch(w, r)
+		if !ok {
+			return nil, false
+		}
+		return repository.PatchLift(path.week, path.day, path.lift, patch), true
+	})
+}
+
+func LiftDelete(repo MesoPartRepository) func(w http.ResponseWriter, r *http.Request) {
+	return editMesoPart(repo, true, true, func(w http.ResponseWriter, r *http.Request, path *mesoPath) (repository.MesoEdit, bool) {
+		return repository.DeleteLift(path.week, path.day, path.lift), true
+	})
+}
+
+// LiftInsert adds a lift to the day at the index in the at query parameter,
+// it is appended without one
+func LiftInsert(repo MesoPartRepository) func(w http.ResponseWriter, r *http.Request) {
+	return editMesoPart(repo, true, false, func(w http.ResponseWriter, r *http.Request, path *mesoPath) (repository.MesoEdit, bool) {
+		at, ok := atParam(w, r)
+		if !ok {
+			return nil, false
+		}
+		var lift models.Lift
+		if !decodeRequest(w, r, &lift) {
+			return nil, false
+		}
+		return repository.InsertLift(path.week, path.day, at, lift), true
+	})
+}
+
+type liftOrderRequest struct {
+	Order []int `json:"order" validate:"required"`
+}
+
+// LiftsReorder puts the lifts of a day in a new order, order lists the
+// current index of every lift in its new position
+func LiftsReorder(repo MesoPartRepository) func(w http.ResponseWriter, r *http.Request) {
+	return editMesoPart(repo, true, false, func(w http.ResponseWriter, r *http.Request, path *mesoPath) (repository.MesoEdit, bool) {
+		var req liftOrderRequest
+		if !decodeRequest(w, r, &req) {
+			return nil, false
+		}
+		return repository.ReorderLifts(path.week, path.day, req.Order), true
+	})
+}
@@ -0,0 +1,304 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/rekram1-node/workout-backend/auth"
+	"github.com/rekram1-node/workout-backend/models"
+	"github.com/rekram1-node/workout-backend/repository"
+	"github.com/rekram1-node/workout-backend/throttle"
+	"github.com/rs/zerolog"
+)
+
+const recoveryCodeCount = 10
+
+type MFARepository interface {
+	StartTOTPEnrollment(ctx context.Context, userUUID, secret string) (*models.User, error)
+	ConfirmTOTP(ctx context.Context, userUUID, code string, recoveryCodeHashes []string) error
+	VerifyMFA(ctx context.Context, userUUID, code string) (*models.User, error)
+	DisableTOTP(ctx context.Context, userUUID, password, code string) error
+	RegenerateRecoveryCodes(ctx context.Context, userUUID, code string, recoveryCodeHashes []string) error
+}
+
+// ChallengeStore makes mfa challenge tokens single use
+type ChallengeStore interface {
+	IsTokenRevoked(ctx context.Context, principal *auth.Principal) (bool, error)
+	RevokeAccessToken(ctx context.Context, userUUID, tokenID string, expiresAt time.Time) error
+}
+
+type mfaCodeRequest struct {
+	Code string `json:"code" validate:"required"`
+}
+
+type mfaDisableRequest struct {
+	Password string `json:"password" validate:"required"`
+	Code     string `json:"code" validate:"required"`
+}
+
+type mfaSigninRequest struct {
+	ChallengeToken string `json:"challenge_token" validate:"required"`
+	Code           string `json:"code" validate:"required"`
+	Device         string `json:"device" validate:"max=64"`
+}
+
+func writeMFAError(w http.ResponseWriter, logger *zerolog.Logger, err error) {
+	switch {
+	case errors.Is(err, repository.ErrInvalidMFACode), errors.Is(err, repository.ErrInvalidPassword):
+		writeResponse(w, http.StatusForbidden, map[string]string{"error": err.Error()})
+	case errors.Is(err, repository.ErrMFAAlreadyEnabled), errors.Is(err, repository.ErrMFANotEnrolled):
+		writeResponse(w, http.StatusConflict, map[string]string{"error": err.Error()})
+	default:
+		logger.Error().Err(err).Msg("two factor operation failed")
+		writeResponse(w, http.StatusInternalServerError, map[string]string{"error": "two factor operation failed"})
+	}
+}
+
+func newRecoveryCodes() ([]string, []string, error) {
+	codes, err := auth.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	hashes := make([]string, 0, len(codes))
+	for _, code := range codes {
+		hashes = append(hashes, auth.HashRecoveryCode(code))
+	}
+
+	return codes, hashes, nil
+}
+
+func MFAEnroll(repo MFARepository, issuer string) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		logger := zerolog.Ctx(ctx)
+		principal, ok := requirePrincipal(w, r)
+		if !ok {
+			return
+		}
+
+		secret, err := auth.GenerateTOTPSecret()
+		if err != nil {
+			logger.Error().Err(err).Msg("failed to generate totp secret")
+			writeResponse(w, http.StatusInternalServerError, map[string]string{"error": "failed to start enrollment"})
+			return
+		}
+
+		user, err := repo.StartTOTPEnrollment(ctx, principal.UserUUID, secret)
+		if err != nil {
+			writeMFAError(w, logger, err)
+			return
+		}
+
+		writeResponse(w, http.StatusOK, map[string]string{
+			"secret":      secret,
+			"otpauth_uri": auth.TOTPURI(issuer, user.Username, secret),
+			"message":     "add the secret to an authenticator app and confirm it with a code",
+		})
+	}
+}
+
+func MFAConfirm(repo MFARepository) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		logger := zerolog.Ctx(ctx)
+		principal, ok := requirePrincipal(w, r)
+		if !ok {
+			return
+		}
+
+		var codeReq mfaCodeRequest
+		if err := json.NewDecoder(r.Body).Decode(&codeReq); err != nil {
+			writeResponse(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		if err := validateRequest(codeReq); err != nil {
+			writeResponse(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+
+		codes, hashes, err := newRecoveryCodes()
+		if err != nil {
+			logger.Error().Err(err).Msg("failed to generate recovery codes")
+			writeResponse(w, http.StatusInternalServerError, map[string]string{"error": "failed to confirm enrollment"})
+			return
+		}
+
+		if err := repo.ConfirmTOTP(ctx, principal.UserUUID, codeReq.Code, hashes); err != nil {
+			writeMFAError(w, logger, err)
+			return
+		}
+
+		logger.Info().Msg("enabled two factor authentication")
+		writeResponse(w, http.StatusOK, map[string]interface{}{
+			"message":        "two factor authentication enabled, store the recovery codes somewhere safe",
+			"recovery_codes": codes,
+		})
+	}
+}
+
+func MFADisable(repo MFARepository) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		logger := zerolog.Ctx(ctx)
+		principal, ok := requirePrincipal(w, r)
+		if !ok {
+			return
+		}
+
+		var disableReq mfaDisableRequest
+		if err := json.NewDecoder(r.Body).Decode(&disableReq); err != nil {
+			writeResponse(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		if err := validateRequest(disableReq); err != nil {
+			writeResponse(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+
+		if err := repo.DisableTOTP(ctx, principal.UserUUID, disableReq.Password, disableReq.Code); err != nil {
+			writeMFAError(w, logger, err)
+			return
+		}
+
+		logger.Info().Msg("disabled two factor authentication")
+		writeResponse(w, http.StatusOK, map[string]string{
+			"message": "two factor authentication disabled",
+		})
+	}
+}
+
+func MFARecoveryCodes(repo MFARepository) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		logger := zerolog.Ctx(ctx)
+		principal, ok := requirePrincipal(w, r)
+		if !ok {
+			return
+		}
+
+		var codeReq mfaCodeRequest
+		if err := json.NewDecoder(r.Body).Decode(&codeReq); err != nil {
+			writeResponse(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		if err := validateRequest(codeReq); err != nil {
+			writeResponse(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+
+		codes, hashes, err := newRecoveryCodes()
+		if err != nil {
+			logger.Error().Err(err).Msg("failed to generate recovery codes")
+			writeResponse(w, http.StatusInternalServerError, map[string]string{"error": "failed to regenerate recovery codes"})
+			return
+		}
+
+		if err := repo.RegenerateRecoveryCodes(ctx, principal.UserUUID, codeReq.Code, hashes); err != nil {
+			writeMFAError(w, logger, err)
+			return
+		}
+
+		writeResponse(w, http.StatusOK, map[string]interface{}{
+			"message":        "previous recovery codes no longer work",
+			"recovery_codes": codes,
+		})
+	}
+}
+
+// LoginMFA exchanges the challenge token handed out by LoginHandler and a
+// TOTP or recovery code for real tokens. Wrong codes count against the same
+// throttle as wrong passwords.
+func LoginMFA(db LoginRepository, mfaRepo MFARepository, tokenRepo TokenRepository, challenges ChallengeStore, tokens auth.TokenConfig, limiter *throttle.Limiter) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		logger := zerolog.Ctx(ctx)
+		var mfaReq mfaSigninRequest
+		if err := json.NewDecoder(r.Body).Decode(&mfaReq); err != nil {
+			writeResponse(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		if err := validateRequest(mfaReq); err != nil {
+			writeResponse(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+
+		claims, err := auth.ParseToken(mfaReq.ChallengeToken, tokens.Keyring, auth.PurposeMFAChallenge)
+		if err != nil {
+			logger.Info().Err(err).Msg("invalid mfa challenge")
+			writeResponse(w, http.StatusUnauthorized, map[string]string{"error": "invalid or expired challenge, sign in again"})
+			return
+		}
+
+		challenge := &auth.Principal{
+			UserUUID:  claims.UUID,
+			Username:  claims.Name,
+			TokenID:   claims.ID,
+			IssuedAt:  claims.IssuedAt.Time,
+			ExpiresAt: claims.ExpiresAt.Time,
+		}
+		used, err := challenges.IsTokenRevoked(ctx, challenge)
+		if err != nil {
+			logger.Error().Err(err).Msg("failed to check mfa challenge")
+			writeResponse(w, http.StatusServiceUnavailable, map[string]string{"error": "unable to sign in right now"})
+			return
+		}
+		if used {
+			writeResponse(w, http.StatusUnauthorized, map[string]string{"error": "invalid or expired challenge, sign in again"})
+			return
+		}
+
+		ip := clientIP(r)
+		wait, err := limiter.Check(ctx, challenge.Username, ip)
+		if err != nil {
+			logger.Error().Err(err).Msg("failed to check sign in throttle")
+			writeResponse(w, http.StatusServiceUnavailable, map[string]string{"error": "unable to sign in right now"})
+			return
+		}
+		if wait > 0 {
+			recordFailedLogin(r, db, challenge.Username, repository.LoginThrottled)
+			writeRetryAfter(w, wait)
+			writeResponse(w, http.StatusTooManyRequests, map[string]string{"error": "too many failed sign in attempts, try again later"})
+			return
+		}
+
+		user, err := mfaRepo.VerifyMFA(ctx, challenge.UserUUID, mfaReq.Code)
+		if err != nil {
+			recordFailedLogin(r, db, challenge.Username, repository.LoginInvalidMFACode)
+			wait, err := limiter.Failure(ctx, challenge.Username, ip)
+			if err != nil {
+				logger.Error().Err(err).Msg("failed to record sign in failure")
+			}
+			writeRetryAfter(w, wait)
+			writeResponse(w, http.StatusUnauthorized, map[string]string{"error": "invalid two factor code"})
+			return
+		}
+
+		if refusal := signInRefusal(user); refusal != "" {
+			writeResponse(w, http.StatusForbidden, map[string]string{"error": refusal})
+			return
+		}
+
+		if err := challenges.RevokeAccessToken(ctx, challenge.UserUUID, challenge.TokenID, challenge.ExpiresAt); err != nil {
+			logger.Error().Err(err).Msg("failed to use up mfa challenge")
+			writeResponse(w, http.StatusServiceUnavailable, map[string]string{"error": "unable to sign in right now"})
+			return
+		}
+
+		if err := limiter.Success(ctx, user.Username); err != nil {
+			logger.Error().Err(err).Msg("failed to reset sign in throttle")
+		}
+
+		res, err := issueTokens(r, tokenRepo, tokens, user, mfaReq.Device)
+		if err != nil {
+			logger.Error().Err(err).Msg("failed to issue tokens")
+			writeResponse(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+
+		writeResponse(w, http.StatusOK, res)
+	}
+}
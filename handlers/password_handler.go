@@ -0,0 +1,158 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/rekram1-node/workout-backend/auth"
+	"github.com/rekram1-node/workout-backend/models"
+	"github.com/rekram1-node/workout-backend/notify"
+	"github.com/rekram1-node/workout-backend/repository"
+	"github.com/rs/zerolog"
+)
+
+type PasswordRepository interface {
+	ChangePassword(ctx context.Context, userUUID string, passwordReq repository.PasswordChangeRequest) error
+	CreatePasswordReset(ctx context.Context, username, tokenHash string, expiresAt time.Time) (*models.User, error)
+	ResetPassword(ctx context.Context, tokenHash, newPassword string) (string, error)
+}
+
+func PasswordChange(repo PasswordRepository, revoker TokenRevoker) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		logger := zerolog.Ctx(ctx)
+		principal, ok := requirePrincipal(w, r)
+		if !ok {
+			return
+		}
+
+		var passwordReq repository.PasswordChangeRequest
+		if err := json.NewDecoder(r.Body).Decode(&passwordReq); err != nil {
+			logger.Warn().Err(err).Msg("failed to unmarshal body request")
+			writeResponse(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		if err := validateRequest(passwordReq); err != nil {
+			writeResponse(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+
+		err := repo.ChangePassword(ctx, principal.UserUUID, passwordReq)
+		switch {
+		case errors.Is(err, repository.ErrInvalidPassword):
+			writeResponse(w, http.StatusForbidden, map[string]string{"error": err.Error()})
+			return
+		case err != nil:
+			logger.Error().Err(err).Msg("failed to change password")
+			writeResponse(w, http.StatusInternalServerError, map[string]string{"error": "failed to change password"})
+			return
+		}
+
+		if err := revoker.RevokeOtherSessions(ctx, principal.UserUUID, principal.SessionID); err != nil {
+			logger.Error().Err(err).Msg("failed to revoke other sessions after password change")
+			writeResponse(w, http.StatusInternalServerError, map[string]string{"error": "password changed but other sessions could not be signed out"})
+			return
+		}
+
+		logger.Info().Msg("successfully changed password")
+		writeResponse(w, http.StatusOK, map[string]string{
+			"message": "successfully changed password, other sessions have been signed out",
+		})
+	}
+}
+
+type passwordForgotRequest struct {
+	Username string `json:"username" validate:"required"`
+}
+
+// PasswordForgot always answers 202 so it can't be used to find out which
+// usernames exist.
+func PasswordForgot(repo PasswordRepository, notifier notify.Notifier, ttl time.Duration) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		logger := zerolog.Ctx(ctx)
+		var forgotReq passwordForgotRequest
+		if err := json.NewDecoder(r.Body).Decode(&forgotReq); err != nil {
+			logger.Warn().Err(err).Msg("failed to unmarshal body request")
+			writeResponse(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		if err := validateRequest(forgotReq); err != nil {
+			writeResponse(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+
+		accepted := map[string]string{
+			"message": "if the account exists a password reset code has been sent",
+		}
+
+		token, tokenHash, err := auth.CreateOpaqueToken()
+		if err != nil {
+			logger.Error().Err(err).Msg("failed to create password reset token")
+			writeResponse(w, http.StatusInternalServerError, map[string]string{"error": "failed to start password reset"})
+			return
+		}
+
+		user, err := repo.CreatePasswordReset(ctx, forgotReq.Username, tokenHash, time.Now().Add(ttl))
+		if err != nil {
+			logger.Info().Err(err).Str("user", forgotReq.Username).Msg("password reset not created")
+			writeResponse(w, http.StatusAccepted, accepted)
+			return
+		}
+
+		if err := notifier.Notify(ctx, passwordResetMessage(user, token, ttl)); err != nil {
+			logger.Error().Err(err).Msg("failed to send password reset")
+		}
+
+		writeResponse(w, http.StatusAccepted, accepted)
+	}
+}
+
+func passwordResetMessage(user *models.User, token string, ttl time.Duration) notify.Message {
+	return notify.Message{
+		To:      user.Username,
+		Subject: "Reset your password",
+		Body:    fmt.Sprintf("Use this code to reset your password: %s\nIt expires in %s. If you did not ask for a reset you can ignore this message.", token, ttl),
+	}
+}
+
+func PasswordReset(repo PasswordRepository, revoker TokenRevoker) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		logger := zerolog.Ctx(ctx)
+		var resetReq repository.PasswordResetRequest
+		if err := json.NewDecoder(r.Body).Decode(&resetReq); err != nil {
+			logger.Warn().Err(err).Msg("failed to unmarshal body request")
+			writeResponse(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		if err := validateRequest(resetReq); err != nil {
+			writeResponse(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+
+		userUUID, err := repo.ResetPassword(ctx, auth.HashOpaqueToken(resetReq.Token), resetReq.NewPassword)
+		switch {
+		case errors.Is(err, repository.ErrPasswordResetInvalid):
+			writeResponse(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		case err != nil:
+			logger.Error().Err(err).Msg("failed to reset password")
+			writeResponse(w, http.StatusInternalServerError, map[string]string{"error": "failed to reset password"})
+			return
+		}
+
+		if err := revoker.RevokeAllTokens(ctx, userUUID); err != nil {
+			logger.Error().Err(err).Msg("failed to revoke sessions after password reset")
+		}
+
+		logger.Info().Str("user", userUUID).Msg("successfully reset password")
+		writeResponse(w, http.StatusOK, map[string]string{
+			"message": "successfully reset password, sign in with the new password",
+		})
+	}
+}
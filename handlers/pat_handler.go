@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/rekram1-node/workout-backend/auth"
+	"github.com/rekram1-node/workout-backend/repository"
+	"github.com/rs/zerolog"
+)
+
+type PersonalAccessTokenRepository interface {
+	CreatePersonalAccessToken(ctx context.Context, userUUID, tokenHash, prefix string, patReq repository.PersonalAccessTokenCreateRequest) (*repository.PersonalAccessTokenResponse, error)
+	ReadPersonalAccessTokens(ctx context.Context, userUUID string) (*[]repository.PersonalAccessTokenResponse, error)
+	RevokePersonalAccessToken(ctx context.Context, userUUID, tokenUUID string) error
+}
+
+// PersonalAccessTokenCreate responds with the token itself, it is not stored
+// and can't be shown again.
+func PersonalAccessTokenCreate(repo PersonalAccessTokenRepository) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		logger := zerolog.Ctx(ctx)
+		principal, ok := requirePrincipal(w, r)
+		if !ok {
+			return
+		}
+
+		var patReq repository.PersonalAccessTokenCreateRequest
+		if err := json.NewDecoder(r.Body).Decode(&patReq); err != nil {
+			logger.Warn().Err(err).Msg("failed to unmarshal body request")
+			writeResponse(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		if err := validateRequest(patReq); err != nil {
+			writeResponse(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		if patReq.ExpiresAt != nil && !patReq.ExpiresAt.After(time.Now()) {
+			writeResponse(w, http.StatusBadRequest, map[string]string{"error": "expires_at must be in the future"})
+			return
+		}
+
+		token, tokenHash, prefix, err := auth.CreatePersonalAccessToken()
+		if err != nil {
+			logger.Error().Err(err).Msg("failed to generate personal access token")
+			writeResponse(w, http.StatusInternalServerError, map[string]string{"error": "failed to create token"})
+			return
+		}
+
+		created, err := repo.CreatePersonalAccessToken(ctx, principal.UserUUID, tokenHash, prefix, patReq)
+		if err != nil {
+			writeResponse(w, http.StatusInternalServerError, map[string]string{"error": "failed to create token"})
+			return
+		}
+		created.Token = token
+
+		logger.Info().Str("token", created.ID).Msg("created personal access token")
+		writeResponse(w, http.StatusCreated, created)
+	}
+}
+
+func PersonalAccessTokensRead(repo PersonalAccessTokenRepository) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		principal, ok := requirePrincipal(w, r)
+		if !ok {
+			return
+		}
+
+		pats, err := repo.ReadPersonalAccessTokens(ctx, principal.UserUUID)
+		if err != nil {
+			writeResponse(w, http.StatusInternalServerError, map[string]string{
+				"error": "failed to read tokens",
+			})
+			return
+		}
+
+		writeResponse(w, http.StatusOK, pats)
+	}
+}
+
+func PersonalAccessTokenDelete(repo PersonalAccessTokenRepository) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		principal, ok := requirePrincipal(w, r)
+		if !ok {
+			return
+		}
+
+		tokenUUID := chi.URLParam(r, "id")
+		if err := repo.RevokePersonalAccessToken(ctx, principal.UserUUID, tokenUUID); err != nil {
+			writeResponse(w, http.StatusNotFound, map[string]string{
+				"error": "no active token found with id: " + tokenUUID,
+			})
+			return
+		}
+
+		writeResponse(w, http.StatusOK, map[string]string{
+			"message": "successfully revoked token: " + tokenUUID,
+		})
+	}
+}
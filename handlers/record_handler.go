@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-chi/chi"
+	"github.com/rekram1-node/workout-backend/models"
+	"github.com/rekram1-node/workout-backend/repository"
+	"github.com/rs/zerolog"
+)
+
+type RecordRepository interface {
+	ReadMeso(ctx context.Context, userUUID, mesoUUID string) (*repository.MesoResponse, error)
+	LogSet(ctx context.Context, req *repository.SetLogRequest) (*repository.SetLogResponse, error)
+	ReadPersonalRecords(ctx context.Context, userUUID string) ([]models.PersonalRecord, error)
+	ReadExerciseRecords(ctx context.Context, userUUID, exerciseUUID string) (*repository.PersonalRecordsResponse, error)
+}
+
+// SetLog records a set and responds with its e1RM and the personal records it
+// set.
+func SetLog(repo RecordRepository) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		logger := zerolog.Ctx(ctx)
+		principal, ok := requirePrincipal(w, r)
+		if !ok {
+			return
+		}
+		indexes, ok := intParams(w, r, "week", "lift", "set")
+		if !ok {
+			return
+		}
+
+		var req repository.SetLogRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			logger.Warn().Err(err).Msg("failed to unmarshal body request")
+			writeResponse(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		if err := validateRequest(req); err != nil {
+			writeResponse(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		req.UserUUID = principal.UserUUID
+		req.MesoUUID = chi.URLParam(r, "uuid")
+		req.Week, req.Lift, req.Set = indexes[0], indexes[1], indexes[2]
+		req.Day = chi.URLParam(r, "day")
+		if req.Version, ok = ifMatch(w, r, repo, principal.UserUUID, req.MesoUUID); !ok {
+			return
+		}
+
+		// an unknown formula comes from the stored setting of the user, not
+		// the request, so it is a server error like any other
+		res, err := repo.LogSet(ctx, &req)
+		if err != nil {
+			writeMesoEditError(w, r, repo, principal.UserUUID, req.MesoUUID, err)
+			return
+		}
+
+		w.Header().Set("ETag", mesoETag(res.Version))
+		writeResponse(w, http.StatusOK, res)
+	}
+}
+
+// PersonalRecordsRead lists the current records of every exercise
+func PersonalRecordsRead(repo RecordRepository) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		principal, ok := requirePrincipal(w, r)
+		if !ok {
+			return
+		}
+
+		records, err := repo.ReadPersonalRecords(ctx, principal.UserUUID)
+		if err != nil {
+			writeResponse(w, http.StatusInternalServerError, map[string]string{
+				"error": "failed to read personal records",
+			})
+			return
+		}
+
+		writeResponse(w, http.StatusOK, records)
+	}
+}
+
+// ExerciseRecordsRead responds with the current records of an exercise and
+// every record that was set on it
+func ExerciseRecordsRead(repo RecordRepository) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		principal, ok := requirePrincipal(w, r)
+		if !ok {
+			return
+		}
+
+		records, err := repo.ReadExerciseRecords(ctx, principal.UserUUID, chi.URLParam(r, "id"))
+		if err != nil {
+			writeResponse(w, http.StatusInternalServerError, map[string]string{
+				"error": "failed to read personal records",
+			})
+			return
+		}
+
+		writeResponse(w, http.StatusOK, records)
+	}
+}
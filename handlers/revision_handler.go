@@ -0,0 +1,144 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi"
+	"github.com/rekram1-node/workout-backend/models"
+	"github.com/rekram1-node/workout-backend/repository"
+	"github.com/rs/zerolog"
+)
+
+type RevisionRepository interface {
+	ReadMeso(ctx context.Context, userUUID, mesoUUID string) (*repository.MesoResponse, error)
+	ReadMesoRevisions(ctx context.Context, userUUID, mesoUUID string) ([]models.MesoRevision, error)
+	ReadMesoRevision(ctx context.Context, userUUID, mesoUUID string, version int) (*repository.MesoResponse, error)
+	DiffMesoRevisions(ctx context.Context, userUUID, mesoUUID string, from, to int) (*repository.MesoRevisionDiff, error)
+	RestoreMesoRevision(ctx context.Context, userUUID, mesoUUID string, version, revision int) (*repository.MesoResponse, error)
+}
+
+// writeRevisionError answers a failed read of the revisions of a meso
+func writeRevisionError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, repository.ErrMesoNotFound) || errors.Is(err, repository.ErrRevisionNotFound) {
+		writeResponse(w, http.StatusNotFound, map[string]string{"error": err.Error()})
+		return
+	}
+
+	zerolog.Ctx(r.Context()).Error().Err(err).Msg("failed to read meso revisions")
+	writeResponse(w, http.StatusInternalServerError, map[string]string{
+		"error": "failed to read meso revisions",
+	})
+}
+
+// MesoRevisionsRead lists who changed a meso when and what they changed,
+// newest first
+func MesoRevisionsRead(repo RevisionRepository) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		principal, ok := requirePrincipal(w, r)
+		if !ok {
+			return
+		}
+
+		revisions, err := repo.ReadMesoRevisions(ctx, principal.UserUUID, chi.URLParam(r, "uuid"))
+		if err != nil {
+			writeRevisionError(w, r, err)
+			return
+		}
+
+		writeResponse(w, http.StatusOK, revisions)
+	}
+}
+
+// MesoRevisionRead responds with the meso as it was at a version
+func MesoRevisionRead(repo RevisionRepository) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		principal, ok := requirePrincipal(w, r)
+		if !ok {
+			return
+		}
+		versions, ok := intParams(w, r, "version")
+		if !ok {
+			return
+		}
+
+		meso, err := repo.ReadMesoRevision(ctx, principal.UserUUID, chi.URLParam(r, "uuid"), versions[0])
+		if err != nil {
+			writeRevisionError(w, r, err)
+			return
+		}
+
+		writeResponse(w, http.StatusOK, meso)
+	}
+}
+
+// MesoRevisionsDiff responds with the JSON Patch between the versions in the
+// from and to query parameters
+func MesoRevisionsDiff(repo RevisionRepository) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		principal, ok := requirePrincipal(w, r)
+		if !ok {
+			return
+		}
+
+		params := r.URL.Query()
+		from, err := strconv.Atoi(params.Get("from"))
+		if err != nil || from < 1 {
+			writeResponse(w, http.StatusBadRequest, map[string]string{"error": "invalid from"})
+			return
+		}
+		to, err := strconv.Atoi(params.Get("to"))
+		if err != nil || to < 1 {
+			writeResponse(w, http.StatusBadRequest, map[string]string{"error": "invalid to"})
+			return
+		}
+
+		diff, err := repo.DiffMesoRevisions(ctx, principal.UserUUID, chi.URLParam(r, "uuid"), from, to)
+		if err != nil {
+			writeRevisionError(w, r, err)
+			return
+		}
+
+		writeResponse(w, http.StatusOK, diff)
+	}
+}
+
+// MesoRevisionRestore puts a meso back the way it was at a version, which
+// is saved as a new version
+func MesoRevisionRestore(repo RevisionRepository) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		principal, ok := requirePrincipal(w, r)
+		if !ok {
+			return
+		}
+		versions, ok := intParams(w, r, "version")
+		if !ok {
+			return
+		}
+		mesoUUID := chi.URLParam(r, "uuid")
+		version, ok := ifMatch(w, r, repo, principal.UserUUID, mesoUUID)
+		if !ok {
+			return
+		}
+
+		meso, err := repo.RestoreMesoRevision(ctx, principal.UserUUID, mesoUUID, version, versions[0])
+		switch {
+		case errors.Is(err, repository.ErrRevisionNotFound):
+			writeResponse(w, http.StatusNotFound, map[string]string{"error": err.Error()})
+			return
+		case err != nil:
+			writeMesoEditError(w, r, repo, principal.UserUUID, mesoUUID, err)
+			return
+		}
+
+		zerolog.Ctx(ctx).Info().Str("meso_uuid", mesoUUID).Int("revision", versions[0]).Msg("restored meso revision")
+		w.Header().Set("ETag", mesoETag(meso.Version))
+		writeResponse(w, http.StatusOK, meso)
+	}
+}
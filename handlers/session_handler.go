@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi"
+	"github.com/rekram1-node/workout-backend/repository"
+	"github.com/rs/zerolog"
+)
+
+type SessionRepository interface {
+	ReadSessions(ctx context.Context, userUUID string) (*[]repository.SessionResponse, error)
+}
+
+func SessionsRead(repo SessionRepository) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		logger := zerolog.Ctx(ctx)
+		principal, ok := requirePrincipal(w, r)
+		if !ok {
+			return
+		}
+
+		sessions, err := repo.ReadSessions(ctx, principal.UserUUID)
+		if err != nil {
+			logger.Error().Err(err).Msg("failed to read sessions")
+			writeResponse(w, http.StatusInternalServerError, map[string]string{
+				"error": "failed to read sessions",
+			})
+			return
+		}
+
+		for i := range *sessions {
+			(*sessions)[i].Current = (*sessions)[i].ID == principal.SessionID
+		}
+
+		writeResponse(w, http.StatusOK, sessions)
+	}
+}
+
+func SessionDelete(revoker TokenRevoker) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		logger := zerolog.Ctx(ctx)
+		principal, ok := requirePrincipal(w, r)
+		if !ok {
+			return
+		}
+
+		sessionUUID := chi.URLParam(r, "id")
+		if err := revoker.RevokeSession(ctx, principal.UserUUID, sessionUUID); err != nil {
+			logger.Error().Err(err).Str("session", sessionUUID).Msg("failed to revoke session")
+			writeResponse(w, http.StatusNotFound, map[string]string{
+				"error": "no active session found with id: " + sessionUUID,
+			})
+			return
+		}
+
+		writeResponse(w, http.StatusOK, map[string]string{
+			"message": "successfully revoked session: " + sessionUUID,
+		})
+	}
+}
+
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
+
+// deviceLabel makes a rough guess at a human readable device from a user agent
+func deviceLabel(userAgent string) string {
+	ua := strings.ToLower(userAgent)
+	for _, device := range []struct{ match, label string }{
+		{"iphone", "iPhone"},
+		{"ipad", "iPad"},
+		{"android", "Android"},
+		{"macintosh", "Mac"},
+		{"windows", "Windows"},
+		{"linux", "Linux"},
+		{"curl", "curl"},
+		{"python", "Python script"},
+	} {
+		if strings.Contains(ua, device.match) {
+			return device.label
+		}
+	}
+
+	return "Unknown device"
+}
@@ -0,0 +1,185 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rekram1-node/workout-backend/auth"
+	"github.com/rekram1-node/workout-backend/models"
+	"github.com/rekram1-node/workout-backend/repository"
+	"github.com/rs/zerolog"
+)
+
+type TokenRepository interface {
+	CreateSession(ctx context.Context, user *models.User, sessionReq repository.SessionCreateRequest) error
+	RotateRefreshToken(ctx context.Context, tokenHash, newTokenHash string, expiresAt time.Time) (*models.User, string, error)
+}
+
+type tokenResponse struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int    `json:"expires_in"`
+	Message      string `json:"message,omitempty"`
+}
+
+// issueTokens starts a new session for user and signs its first access and
+// refresh tokens.
+func issueTokens(r *http.Request, repo TokenRepository, tokens auth.TokenConfig, user *models.User, device string) (*tokenResponse, error) {
+	sessionUUID := uuid.NewString()
+	accessToken, err := auth.CreateAccessToken(user, sessionUUID, tokens)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken, refreshHash, err := auth.CreateOpaqueToken()
+	if err != nil {
+		return nil, err
+	}
+
+	userAgent := r.UserAgent()
+	if device == "" {
+		device = deviceLabel(userAgent)
+	}
+
+	sessionReq := repository.SessionCreateRequest{
+		UUID:        sessionUUID,
+		DeviceLabel: device,
+		UserAgent:   userAgent,
+		IP:          clientIP(r),
+		TokenHash:   refreshHash,
+		ExpiresAt:   time.Now().Add(tokens.RefreshTokenTTL),
+	}
+	if err := repo.CreateSession(r.Context(), user, sessionReq); err != nil {
+		return nil, err
+	}
+
+	return &tokenResponse{
+		Token:        accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int(tokens.AccessTokenTTL.Seconds()),
+	}, nil
+}
+
+type refreshRequest struct {
+	RefreshToken string `json:"refresh_token" validate:"required"`
+}
+
+func TokenRefresh(repo TokenRepository, tokens auth.TokenConfig) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		logger := zerolog.Ctx(ctx)
+		var refreshReq refreshRequest
+		if err := json.NewDecoder(r.Body).Decode(&refreshReq); err != nil {
+			logger.Warn().Err(err).Msg("failed to unmarshal body request")
+			writeResponse(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		if err := validateRequest(refreshReq); err != nil {
+			writeResponse(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+
+		refreshToken, refreshHash, err := auth.CreateOpaqueToken()
+		if err != nil {
+			logger.Error().Err(err).Msg("failed to create refresh token")
+			writeResponse(w, http.StatusInternalServerError, map[string]string{"error": "failed to refresh token"})
+			return
+		}
+
+		user, familyID, err := repo.RotateRefreshToken(ctx, auth.HashOpaqueToken(refreshReq.RefreshToken), refreshHash, time.Now().Add(tokens.RefreshTokenTTL))
+		switch {
+		case errors.Is(err, repository.ErrRefreshTokenInvalid),
+			errors.Is(err, repository.ErrRefreshTokenExpired),
+			errors.Is(err, repository.ErrRefreshTokenReused):
+			logger.Info().Err(err).Msg("rejected refresh token")
+			writeResponse(w, http.StatusUnauthorized, map[string]string{"error": err.Error()})
+			return
+		case err != nil:
+			logger.Error().Err(err).Msg("failed to rotate refresh token")
+			writeResponse(w, http.StatusInternalServerError, map[string]string{"error": "failed to refresh token"})
+			return
+		}
+
+		accessToken, err := auth.CreateAccessToken(user, familyID, tokens)
+		if err != nil {
+			logger.Error().Err(err).Msg("failed to create access token")
+			writeResponse(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+
+		writeResponse(w, http.StatusOK, tokenResponse{
+			Token:        accessToken,
+			RefreshToken: refreshToken,
+			ExpiresIn:    int(tokens.AccessTokenTTL.Seconds()),
+		})
+	}
+}
+
+type TokenRevoker interface {
+	RevokeAccessToken(ctx context.Context, userUUID, tokenID string, expiresAt time.Time) error
+	RevokeSession(ctx context.Context, userUUID, sessionUUID string) error
+	RevokeOtherSessions(ctx context.Context, userUUID, keepSessionUUID string) error
+	RevokeAllTokens(ctx context.Context, userUUID string) error
+}
+
+func UserSignout(revoker TokenRevoker) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		logger := zerolog.Ctx(ctx)
+		principal, ok := requirePrincipal(w, r)
+		if !ok {
+			return
+		}
+
+		if err := revoker.RevokeAccessToken(ctx, principal.UserUUID, principal.TokenID, principal.ExpiresAt); err != nil {
+			logger.Error().Err(err).Msg("failed to revoke access token")
+			writeResponse(w, http.StatusInternalServerError, map[string]string{"error": "failed to sign out"})
+			return
+		}
+
+		if principal.SessionID != "" {
+			if err := revoker.RevokeSession(ctx, principal.UserUUID, principal.SessionID); err != nil {
+				logger.Error().Err(err).Msg("failed to revoke refresh tokens")
+				writeResponse(w, http.StatusInternalServerError, map[string]string{"error": "failed to sign out"})
+				return
+			}
+		}
+
+		writeResponse(w, http.StatusOK, map[string]string{
+			"message": "successfully signed out",
+		})
+	}
+}
+
+func UserSignoutAll(revoker TokenRevoker) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		logger := zerolog.Ctx(ctx)
+		principal, ok := requirePrincipal(w, r)
+		if !ok {
+			return
+		}
+
+		if err := revoker.RevokeAllTokens(ctx, principal.UserUUID); err != nil {
+			logger.Error().Err(err).Msg("failed to revoke all tokens")
+			writeResponse(w, http.StatusInternalServerError, map[string]string{"error": "failed to sign out"})
+			return
+		}
+
+		writeResponse(w, http.StatusOK, map[string]string{
+			"message": "successfully signed out of every session",
+		})
+	}
+}
+
+func JWKSRead(keyring *auth.Keyring) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "public, max-age=300")
+		writeResponse(w, http.StatusOK, keyring.JWKS())
+	}
+}
@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/rekram1-node/workout-backend/models"
+	"github.com/rekram1-node/workout-backend/repository"
+	"github.com/rekram1-node/workout-backend/throttle"
+	"github.com/rs/zerolog"
+)
+
+type TrashRepository interface {
+	ReadTrashedMesos(ctx context.Context, userUUID string) ([]repository.TrashedMeso, error)
+	RestoreMeso(ctx context.Context, userUUID, mesoUUID string) (*repository.MesoResponse, error)
+}
+
+type UndoDeleteRepository interface {
+	UndoDeleteUser(ctx context.Context, req repository.UndoDeleteRequest, grace time.Duration) (*models.User, error)
+}
+
+type trashedMesoResponse struct {
+	repository.TrashedMeso
+	// PurgeAt is when the meso is deleted for good
+	PurgeAt time.Time
+}
+
+// MesoTrashRead lists the deleted mesos of the user and when each of them
+// will be purged
+func MesoTrashRead(repo TrashRepository, retention time.Duration) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		principal, ok := requirePrincipal(w, r)
+		if !ok {
+			return
+		}
+
+		mesos, err := repo.ReadTrashedMesos(ctx, principal.UserUUID)
+		if err != nil {
+			writeResponse(w, http.StatusInternalServerError, map[string]string{
+				"error": "failed to read trash",
+			})
+			return
+		}
+
+		trash := make([]trashedMesoResponse, 0, len(mesos))
+		for _, meso := range mesos {
+			trash = append(trash, trashedMesoResponse{TrashedMeso: meso, PurgeAt: meso.DeletedAt.Add(retention)})
+		}
+
+		writeResponse(w, http.StatusOK, trash)
+	}
+}
+
+func MesoRestore(repo TrashRepository) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		principal, ok := requirePrincipal(w, r)
+		if !ok {
+			return
+		}
+
+		mesoUUID := chi.URLParam(r, "uuid")
+		meso, err := repo.RestoreMeso(ctx, principal.UserUUID, mesoUUID)
+		switch {
+		case errors.Is(err, repository.ErrMesoNotDeleted):
+			writeResponse(w, http.StatusConflict, map[string]string{"error": err.Error()})
+			return
+		case errors.Is(err, repository.ErrMesoNotFound):
+			writeResponse(w, http.StatusNotFound, map[string]string{
+				"error": "no deleted meso found with uuid: " + mesoUUID,
+			})
+			return
+		case err != nil:
+			zerolog.Ctx(ctx).Error().Err(err).Msg("failed to restore meso")
+			writeResponse(w, http.StatusInternalServerError, map[string]string{
+				"error": "failed to restore meso",
+			})
+			return
+		}
+
+		w.Header().Set("ETag", mesoETag(meso.Version))
+		writeResponse(w, http.StatusOK, meso)
+	}
+}
+
+// UserUndoDelete restores a deleted account during its grace period. The
+// account can't sign in once deleted, so it takes the same credentials as
+// sign in and is throttled like it.
+func UserUndoDelete(repo UndoDeleteRepository, limiter *throttle.Limiter, grace time.Duration) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		logger := zerolog.Ctx(ctx)
+		var req repository.UndoDeleteRequest
+		if !decodeRequest(w, r, &req) {
+			return
+		}
+
+		ip := clientIP(r)
+		wait, err := limiter.Check(ctx, req.Username, ip)
+		if err != nil {
+			logger.Error().Err(err).Msg("failed to check sign in throttle")
+			writeResponse(w, http.StatusServiceUnavailable, map[string]string{"error": "unable to restore account right now"})
+			return
+		}
+		if wait > 0 {
+			writeRetryAfter(w, wait)
+			writeResponse(w, http.StatusTooManyRequests, map[string]string{"error": "too many failed attempts, try again later"})
+			return
+		}
+
+		user, err := repo.UndoDeleteUser(ctx, req, grace)
+		if err != nil {
+			wait, ferr := limiter.Failure(ctx, req.Username, ip)
+			if ferr != nil {
+				logger.Error().Err(ferr).Msg("failed to record sign in failure")
+			}
+			writeRetryAfter(w, wait)
+
+			message := "no deleted account found with those credentials"
+			if errors.Is(err, repository.ErrInvalidMFACode) {
+				message = "invalid two factor code"
+			}
+			writeResponse(w, http.StatusUnauthorized, map[string]string{"error": message})
+			return
+		}
+
+		if err := limiter.Success(ctx, req.Username); err != nil {
+			logger.Error().Err(err).Msg("failed to reset sign in throttle")
+		}
+
+		writeResponse(w, http.StatusOK, map[string]string{
+			"message": "successfully restored user: " + user.UUID,
+		})
+	}
+}
@@ -3,19 +3,24 @@ package handlers
 import (
 	"context"
 	"encoding/json"
+	"math"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/rekram1-node/workout-backend/auth"
 	"github.com/rekram1-node/workout-backend/models"
 	"github.com/rekram1-node/workout-backend/repository"
+	"github.com/rekram1-node/workout-backend/throttle"
 	"github.com/rs/zerolog"
 )
 
 type LoginRepository interface {
 	FindUserByCredentials(ctx context.Context, signInRequest repository.UserSignInRequest) (*models.User, error)
+	RecordFailedLogin(ctx context.Context, attempt *models.LoginAttempt) error
 }
 
-func LoginHandler(db LoginRepository, secret string) func(w http.ResponseWriter, r *http.Request) {
+func LoginHandler(db LoginRepository, tokenRepo TokenRepository, tokens auth.TokenConfig, limiter *throttle.Limiter) func(w http.ResponseWriter, r *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
 		ctx := r.Context()
 		logger := zerolog.Ctx(ctx)
@@ -29,23 +34,102 @@ func LoginHandler(db LoginRepository, secret string) func(w http.ResponseWriter,
 			writeResponse(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
 			return
 		}
+
+		ip := clientIP(r)
+		wait, err := limiter.Check(ctx, signinReq.Username, ip)
+		if err != nil {
+			logger.Error().Err(err).Msg("failed to check sign in throttle")
+			writeResponse(w, http.StatusServiceUnavailable, map[string]string{"error": "unable to sign in right now"})
+			return
+		}
+		if wait > 0 {
+			recordFailedLogin(r, db, signinReq.Username, repository.LoginThrottled)
+			writeRetryAfter(w, wait)
+			writeResponse(w, http.StatusTooManyRequests, map[string]string{"error": "too many failed sign in attempts, try again later"})
+			return
+		}
+
 		user, err := db.FindUserByCredentials(ctx, signinReq)
 		if err != nil {
+			recordFailedLogin(r, db, signinReq.Username, repository.LoginInvalidCredentials)
+			wait, err := limiter.Failure(ctx, signinReq.Username, ip)
+			if err != nil {
+				logger.Error().Err(err).Msg("failed to record sign in failure")
+			}
+			writeRetryAfter(w, wait)
 			writeResponse(w, http.StatusUnauthorized, map[string]string{"error": "unable to locate user"})
 			return
 		}
 
-		token, err := auth.CreateAccessToken(user, secret)
+		if refusal := signInRefusal(user); refusal != "" {
+			writeResponse(w, http.StatusForbidden, map[string]string{"error": refusal})
+			return
+		}
+
+		// with two factor enabled the throttle is only reset once the code
+		// is right too, otherwise the password could be used to keep
+		// resetting it while guessing codes
+		if user.MFAEnabled {
+			challenge, err := auth.CreateMFAChallenge(user, tokens)
+			if err != nil {
+				logger.Error().Err(err).Msg("failed to create mfa challenge")
+				writeResponse(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+				return
+			}
+
+			writeResponse(w, http.StatusOK, map[string]interface{}{
+				"mfa_required":    true,
+				"challenge_token": challenge,
+				"expires_in":      int(auth.MFAChallengeTTL.Seconds()),
+			})
+			return
+		}
+
+		if err := limiter.Success(ctx, signinReq.Username); err != nil {
+			logger.Error().Err(err).Msg("failed to reset sign in throttle")
+		}
+
+		res, err := issueTokens(r, tokenRepo, tokens, user, signinReq.Device)
 		if err != nil {
-			logger.Error().Err(err).Msg("failed to create access token")
-			writeResponse(w, http.StatusUnauthorized, map[string]string{"error": err.Error()})
+			logger.Error().Err(err).Msg("failed to issue tokens")
+			writeResponse(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
 			return
 		}
 
-		writeResponse(w, http.StatusOK, map[string]string{
-			"token": token,
-		})
+		writeResponse(w, http.StatusOK, res)
+	}
+}
+
+// signInRefusal is why a user with the right credentials still can't sign in
+func signInRefusal(user *models.User) string {
+	switch {
+	case user.SuspendedAt != nil:
+		return "account is suspended"
+	case user.PasswordResetRequired:
+		return "a password reset is required, use forgot password to set a new one"
+	}
+
+	return ""
+}
+
+func recordFailedLogin(r *http.Request, db LoginRepository, username, reason string) {
+	attempt := &models.LoginAttempt{
+		Username:  username,
+		IP:        clientIP(r),
+		UserAgent: r.UserAgent(),
+		Reason:    reason,
 	}
+	// the repository logs its own errors, a failed audit write shouldn't
+	// change the response
+	_ = db.RecordFailedLogin(r.Context(), attempt)
+}
+
+func writeRetryAfter(w http.ResponseWriter, wait time.Duration) {
+	if wait <= 0 {
+		return
+	}
+
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
 }
 
 type UserRepository interface {
@@ -55,7 +139,7 @@ type UserRepository interface {
 	UpdateUser(ctx context.Context, uuid string, updatedUser repository.UserUpdateRequest) error
 }
 
-func UserCreate(repo UserRepository, secret string) func(w http.ResponseWriter, r *http.Request) {
+func UserCreate(repo UserRepository, tokenRepo TokenRepository, tokens auth.TokenConfig) func(w http.ResponseWriter, r *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
 		ctx := r.Context()
 		logger := zerolog.Ctx(ctx)
@@ -81,17 +165,15 @@ func UserCreate(repo UserRepository, secret string) func(w http.ResponseWriter,
 			return
 		}
 
-		token, err := auth.CreateAccessToken(user, secret)
+		res, err := issueTokens(r, tokenRepo, tokens, user, "")
 		if err != nil {
-			logger.Error().Err(err).Msg("failed to create access token")
-			writeResponse(w, http.StatusUnauthorized, map[string]string{"error": err.Error()})
+			logger.Error().Err(err).Msg("failed to issue tokens")
+			writeResponse(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
 			return
 		}
 
-		writeResponse(w, http.StatusOK, map[string]string{
-			"token":   token,
-			"message": "successfully created user",
-		})
+		res.Message = "successfully created user"
+		writeResponse(w, http.StatusOK, res)
 	}
 }
 
@@ -99,14 +181,11 @@ func UserUpdate(repo UserRepository) func(w http.ResponseWriter, r *http.Request
 	return func(w http.ResponseWriter, r *http.Request) {
 		ctx := r.Context()
 		logger := zerolog.Ctx(ctx)
-		userUUID := r.Header.Get("UUID")
-		if userUUID == "" {
-			logger.Error().Msg("unable to read user uuid from context")
-			writeResponse(w, http.StatusInternalServerError, map[string]string{
-				"error": "invalid token",
-			})
+		principal, ok := requirePrincipal(w, r)
+		if !ok {
 			return
 		}
+		userUUID := principal.UserUUID
 		var updatedUser repository.UserUpdateRequest
 		if err := json.NewDecoder(r.Body).Decode(&updatedUser); err != nil {
 			logger.Debug().Err(err).Msg("unable to bind client struct")
@@ -140,28 +219,35 @@ func UserRead(repo UserRepository) func(w http.ResponseWriter, r *http.Request)
 	return func(w http.ResponseWriter, r *http.Request) {
 		ctx := r.Context()
 		logger := zerolog.Ctx(ctx)
-		userUUID := r.Header.Get("UUID")
+		principal, ok := requirePrincipal(w, r)
+		if !ok {
+			return
+		}
+		userUUID := principal.UserUUID
 		user, err := repo.ReadUser(ctx, userUUID)
 		if err != nil {
 			logger.Error().Err(err).Msgf("failed to read user info for user: %s", userUUID)
+			writeResponse(w, http.StatusNotFound, map[string]string{
+				"error": "unable to locate user",
+			})
+			return
 		}
 
 		writeResponse(w, http.StatusOK, *user)
 	}
 }
 
-func UserDelete(repo UserRepository) func(w http.ResponseWriter, r *http.Request) {
+// UserDelete deletes the account of the user, it can be restored with
+// UserUndoDelete until grace has passed and is purged after
+func UserDelete(repo UserRepository, grace time.Duration) func(w http.ResponseWriter, r *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
 		ctx := r.Context()
 		logger := zerolog.Ctx(ctx)
-		userUUID := r.Header.Get("UUID")
-		if userUUID == "" {
-			logger.Error().Msg("unable to read user uuid from context")
-			writeResponse(w, http.StatusInternalServerError, map[string]string{
-				"error": "invalid token",
-			})
+		principal, ok := requirePrincipal(w, r)
+		if !ok {
 			return
 		}
+		userUUID := principal.UserUUID
 
 		if err := repo.DeleteUser(ctx, userUUID); err != nil {
 			logger.Error().Err(err).Msgf("failed to delete user: %s", userUUID)
@@ -172,7 +258,8 @@ func UserDelete(repo UserRepository) func(w http.ResponseWriter, r *http.Request
 		}
 
 		writeResponse(w, http.StatusOK, map[string]string{
-			"message": "successfully deleted user: " + userUUID,
+			"message":  "successfully deleted user: " + userUUID,
+			"purge_at": time.Now().Add(grace).UTC().Format(time.RFC3339),
 		})
 	}
 }
@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi"
+	"github.com/rekram1-node/workout-backend/models"
+	"github.com/rekram1-node/workout-backend/repository"
+	"github.com/rs/zerolog"
+)
+
+type VolumeRepository interface {
+	ReadMesoVolume(ctx context.Context, userUUID, mesoUUID string, secondaryCredit float64) (*repository.MesoVolumeResponse, error)
+	ReadVolumeLandmarks(ctx context.Context, userUUID string) ([]models.VolumeLandmark, error)
+	SetVolumeLandmarks(ctx context.Context, userUUID string, req *repository.VolumeLandmarksRequest) ([]models.VolumeLandmark, error)
+}
+
+// MesoVolume responds with the sets per muscle group of every week of the
+// meso. Secondary muscles get secondaryCredit of a set unless the
+// secondary_credit query parameter says otherwise.
+func MesoVolume(repo VolumeRepository, secondaryCredit float64) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		principal, ok := requirePrincipal(w, r)
+		if !ok {
+			return
+		}
+
+		credit := secondaryCredit
+		if param := r.URL.Query().Get("secondary_credit"); param != "" {
+			parsed, err := strconv.ParseFloat(param, 64)
+			if err != nil || parsed < 0 || parsed > 1 {
+				writeResponse(w, http.StatusBadRequest, map[string]string{
+					"error": "secondary_credit must be between 0 and 1",
+				})
+				return
+			}
+			credit = parsed
+		}
+
+		mesoUUID := chi.URLParam(r, "uuid")
+		res, err := repo.ReadMesoVolume(ctx, principal.UserUUID, mesoUUID, credit)
+		switch {
+		case errors.Is(err, repository.ErrMesoNotFound):
+			writeResponse(w, http.StatusNotFound, map[string]string{
+				"error": "no meso found with uuid: " + mesoUUID,
+			})
+			return
+		case err != nil:
+			zerolog.Ctx(ctx).Error().Err(err).Msg("failed to read meso volume")
+			writeResponse(w, http.StatusInternalServerError, map[string]string{
+				"error": "failed to read meso volume",
+			})
+			return
+		}
+
+		writeResponse(w, http.StatusOK, res)
+	}
+}
+
+func VolumeLandmarksRead(repo VolumeRepository) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		principal, ok := requirePrincipal(w, r)
+		if !ok {
+			return
+		}
+
+		landmarks, err := repo.ReadVolumeLandmarks(ctx, principal.UserUUID)
+		if err != nil {
+			writeResponse(w, http.StatusInternalServerError, map[string]string{
+				"error": "failed to read volume landmarks",
+			})
+			return
+		}
+
+		writeResponse(w, http.StatusOK, landmarks)
+	}
+}
+
+func VolumeLandmarksUpdate(repo VolumeRepository) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		principal, ok := requirePrincipal(w, r)
+		if !ok {
+			return
+		}
+
+		var req repository.VolumeLandmarksRequest
+		if !decodeRequest(w, r, &req) {
+			return
+		}
+
+		landmarks, err := repo.SetVolumeLandmarks(ctx, principal.UserUUID, &req)
+		if err != nil {
+			writeResponse(w, http.StatusInternalServerError, map[string]string{
+				"error": "failed to set volume landmarks",
+			})
+			return
+		}
+
+		writeResponse(w, http.StatusOK, landmarks)
+	}
+}
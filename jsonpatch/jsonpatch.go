@@ -0,0 +1,478 @@
+// Package jsonpatch applies JSON Merge Patch (RFC 7396) and JSON Patch
+// (RFC 6902) documents to JSON documents, and makes JSON Patches out of the
+// difference between two documents.
+package jsonpatch
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Media types of the patch documents
+const (
+	MergePatchType = "application/merge-patch+json"
+	JSONPatchType  = "application/json-patch+json"
+)
+
+var (
+	ErrInvalidPatch = errors.New("invalid patch")
+	// ErrInvalidPath is a path that doesn't point into the document, or
+	// points where the operation can't be applied
+	ErrInvalidPath = errors.New("invalid path")
+	ErrTestFailed  = errors.New("test failed")
+)
+
+// MergePatch applies a JSON Merge Patch to doc. Objects in patch are merged
+// into doc member by member, a null member removes it and anything else
+// replaces what is there.
+func MergePatch(doc, patch []byte) ([]byte, error) {
+	target, err := decode(doc)
+	if err != nil {
+		return nil, err
+	}
+	changes, err := decode(patch)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPatch, err)
+	}
+
+	return json.Marshal(merge(target, changes))
+}
+
+func merge(target, patch interface{}) interface{} {
+	changes, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	object, ok := target.(map[string]interface{})
+	if !ok {
+		object = map[string]interface{}{}
+	}
+
+	for name, value := range changes {
+		if value == nil {
+			delete(object, name)
+			continue
+		}
+		object[name] = merge(object[name], value)
+	}
+
+	return object
+}
+
+type operation struct {
+	Op    string          `json:"op"`
+	Path  *string         `json:"path"`
+	From  *string         `json:"from"`
+	Value json.RawMessage `json:"value"`
+}
+
+// Apply applies a JSON Patch, a list of add, remove, replace, move, copy and
+// test operations, to doc. The operations are applied in order and the patch
+// fails as a whole when one of them does.
+func Apply(doc, patch []byte) ([]byte, error) {
+	target, err := decode(doc)
+	if err != nil {
+		return nil, err
+	}
+	var operations []operation
+	if err := json.Unmarshal(patch, &operations); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPatch, err)
+	}
+
+	for i, op := range operations {
+		if target, err = op.apply(target); err != nil {
+			return nil, fmt.Errorf("operation %d (%s): %w", i, op.Op, err)
+		}
+	}
+
+	return json.Marshal(target)
+}
+
+func (op operation) apply(doc interface{}) (interface{}, error) {
+	if op.Path == nil {
+		return nil, fmt.Errorf("%w: missing path", ErrInvalidPatch)
+	}
+	path, err := parsePointer(*op.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch op.Op {
+	case "add", "replace", "test":
+		if op.Value == nil {
+			return nil, fmt.Errorf("%w: missing value", ErrInvalidPatch)
+		}
+		value, err := decode(op.Value)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidPatch, err)
+		}
+
+		switch op.Op {
+		case "add":
+			return add(doc, path, *op.Path, value)
+		case "replace":
+			if doc, _, err = remove(doc, path, *op.Path); err != nil {
+				return nil, err
+			}
+			return add(doc, path, *op.Path, value)
+		default:
+			current, err := get(doc, path, *op.Path)
+			if err != nil {
+				return nil, err
+			}
+			if !equal(current, value) {
+				return nil, fmt.Errorf("%w: value at %q differs", ErrTestFailed, *op.Path)
+			}
+			return doc, nil
+		}
+
+	case "remove":
+		doc, _, err = remove(doc, path, *op.Path)
+		return doc, err
+
+	case "move", "copy":
+		if op.From == nil {
+			return nil, fmt.Errorf("%w: missing from", ErrInvalidPatch)
+		}
+		from, err := parsePointer(*op.From)
+		if err != nil {
+			return nil, err
+		}
+
+		var value interface{}
+		if op.Op == "copy" {
+			if value, err = get(doc, from, *op.From); err != nil {
+				return nil, err
+			}
+			if value, err = deepCopy(value); err != nil {
+				return nil, err
+			}
+		} else {
+			if strings.HasPrefix(*op.Path, *op.From+"/") {
+				return nil, fmt.Errorf("%w: can't move %q into itself", ErrInvalidPath, *op.From)
+			}
+			if doc, value, err = remove(doc, from, *op.From); err != nil {
+				return nil, err
+			}
+		}
+		return add(doc, path, *op.Path, value)
+	}
+
+	return nil, fmt.Errorf("%w: unknown op %q", ErrInvalidPatch, op.Op)
+}
+
+// change is an operation of a patch Diff makes, Value is left out of
+// removes
+type change struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// Diff returns the JSON Patch that turns a into b. Objects are compared
+// member by member and arrays index by index, so an element inserted in the
+// middle of an array replaces every element after it.
+func Diff(a, b []byte) ([]byte, error) {
+	from, err := decode(a)
+	if err != nil {
+		return nil, err
+	}
+	to, err := decode(b)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := []change{}
+	if err := diff(&changes, "", from, to); err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(changes)
+}
+
+func diff(changes *[]change, pointer string, a, b interface{}) error {
+	add := func(op, path string, value interface{}) error {
+		raw, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		*changes = append(*changes, change{Op: op, Path: path, Value: raw})
+		return nil
+	}
+
+	switch x := a.(type) {
+	case map[string]interface{}:
+		y, ok := b.(map[string]interface{})
+		if !ok {
+			break
+		}
+		for _, name := range sortedNames(x) {
+			path := pointer + "/" + escape(name)
+			if value, ok := y[name]; !ok {
+				*changes = append(*changes, change{Op: "remove", Path: path})
+			} else if err := diff(changes, path, x[name], value); err != nil {
+				return err
+			}
+		}
+		for _, name := range sortedNames(y) {
+			if _, ok := x[name]; !ok {
+				if err := add("add", pointer+"/"+escape(name), y[name]); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+
+	case []interface{}:
+		y, ok := b.([]interface{})
+		if !ok {
+			break
+		}
+		for i := 0; i < len(x) && i < len(y); i++ {
+			if err := diff(changes, pointer+"/"+strconv.Itoa(i), x[i], y[i]); err != nil {
+				return err
+			}
+		}
+		for i := len(x); i < len(y); i++ {
+			if err := add("add", pointer+"/"+strconv.Itoa(i), y[i]); err != nil {
+				return err
+			}
+		}
+		for i := len(x) - 1; i >= len(y); i-- {
+			*changes = append(*changes, change{Op: "remove", Path: pointer + "/" + strconv.Itoa(i)})
+		}
+		return nil
+	}
+
+	if equal(a, b) {
+		return nil
+	}
+	return add("replace", pointer, b)
+}
+
+func sortedNames(object map[string]interface{}) []string {
+	names := make([]string, 0, len(object))
+	for name := range object {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// escape makes name a reference token of a JSON Pointer
+func escape(name string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(name)
+}
+
+// parsePointer splits a JSON Pointer (RFC 6901) into its reference tokens
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if pointer[0] != '/' {
+		return nil, fmt.Errorf("%w %q: must start with /", ErrInvalidPath, pointer)
+	}
+
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+	}
+
+	return tokens, nil
+}
+
+// index reads an array index out of token, "-" is the end of the array
+// when end is set
+func index(token string, length int, end bool, pointer string) (int, error) {
+	if end && token == "-" {
+		return length, nil
+	}
+	i, err := strconv.Atoi(token)
+	if err != nil || i < 0 || (len(token) > 1 && token[0] == '0') || i > length || (i == length && !end) {
+		return 0, fmt.Errorf("%w %q: no index %s in an array of %d", ErrInvalidPath, pointer, token, length)
+	}
+
+	return i, nil
+}
+
+// walk follows path up to its last token and replaces the container there
+// with what at returns for it
+func walk(doc interface{}, path []string, pointer string, at func(container interface{}, token string) (interface{}, error)) (interface{}, error) {
+	if len(path) == 1 {
+		return at(doc, path[0])
+	}
+
+	switch node := doc.(type) {
+	case map[string]interface{}:
+		child, ok := node[path[0]]
+		if !ok {
+			break
+		}
+		child, err := walk(child, path[1:], pointer, at)
+		if err != nil {
+			return nil, err
+		}
+		node[path[0]] = child
+		return node, nil
+
+	case []interface{}:
+		i, err := index(path[0], len(node), false, pointer)
+		if err != nil {
+			return nil, err
+		}
+		child, err := walk(node[i], path[1:], pointer, at)
+		if err != nil {
+			return nil, err
+		}
+		node[i] = child
+		return node, nil
+	}
+
+	return nil, fmt.Errorf("%w %q: nothing at %q", ErrInvalidPath, pointer, path[0])
+}
+
+func get(doc interface{}, path []string, pointer string) (interface{}, error) {
+	var value interface{}
+	if len(path) == 0 {
+		return doc, nil
+	}
+	_, err := walk(doc, path, pointer, func(container interface{}, token string) (interface{}, error) {
+		switch node := container.(type) {
+		case map[string]interface{}:
+			member, ok := node[token]
+			if !ok {
+				break
+			}
+			value = member
+			return node, nil
+		case []interface{}:
+			i, err := index(token, len(node), false, pointer)
+			if err != nil {
+				return nil, err
+			}
+			value = node[i]
+			return node, nil
+		}
+		return nil, fmt.Errorf("%w %q: nothing at %q", ErrInvalidPath, pointer, token)
+	})
+
+	return value, err
+}
+
+func add(doc interface{}, path []string, pointer string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	return walk(doc, path, pointer, func(container interface{}, token string) (interface{}, error) {
+		switch node := container.(type) {
+		case map[string]interface{}:
+			node[token] = value
+			return node, nil
+		case []interface{}:
+			i, err := index(token, len(node), true, pointer)
+			if err != nil {
+				return nil, err
+			}
+			node = append(node, nil)
+			copy(node[i+1:], node[i:])
+			node[i] = value
+			return node, nil
+		}
+		return nil, fmt.Errorf("%w %q: can't add to a value that isn't an object or array", ErrInvalidPath, pointer)
+	})
+}
+
+func remove(doc interface{}, path []string, pointer string) (interface{}, interface{}, error) {
+	if len(path) == 0 {
+		return nil, doc, nil
+	}
+	var removed interface{}
+	doc, err := walk(doc, path, pointer, func(container interface{}, token string) (interface{}, error) {
+		switch node := container.(type) {
+		case map[string]interface{}:
+			member, ok := node[token]
+			if !ok {
+				break
+			}
+			removed = member
+			delete(node, token)
+			return node, nil
+		case []interface{}:
+			i, err := index(token, len(node), false, pointer)
+			if err != nil {
+				return nil, err
+			}
+			removed = node[i]
+			return append(node[:i], node[i+1:]...), nil
+		}
+		return nil, fmt.Errorf("%w %q: nothing at %q", ErrInvalidPath, pointer, token)
+	})
+
+	return doc, removed, err
+}
+
+func decode(data []byte) (interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var v interface{}
+	if err := decoder.Decode(&v); err != nil {
+		return nil, err
+	}
+
+	return v, nil
+}
+
+func deepCopy(v interface{}) (interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	return decode(data)
+}
+
+// equal compares decoded JSON values, numbers are equal when their values
+// are so 1 and 1.0 are the same
+func equal(a, b interface{}) bool {
+	switch x := a.(type) {
+	case json.Number:
+		y, ok := b.(json.Number)
+		if !ok {
+			return false
+		}
+		fx, errx := x.Float64()
+		fy, erry := y.Float64()
+		return errx == nil && erry == nil && fx == fy
+	case map[string]interface{}:
+		y, ok := b.(map[string]interface{})
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for name, value := range x {
+			other, ok := y[name]
+			if !ok || !equal(value, other) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		y, ok := b.([]interface{})
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for i := range x {
+			if !equal(x[i], y[i]) {
+				return false
+			}
+		}
+		return true
+	}
+
+	return a == b
+}
@@ -0,0 +1,503 @@
+package jsonpatch
+
+import (
+	"errors"
+	"testing"
+)
+
+// sameJSON reports whether a and b are the same JSON document
+func sameJSON(t *testing.T, a, b []byte) bool {
+	t.Helper()
+	x, err := decode(a)
+	if err != nil {
+		t.Fatalf("invalid JSON %s: %v", a, err)
+	}
+	y, err := decode(b)
+	if err != nil {
+		t.Fatalf("invalid JSON %s: %v", b, err)
+	}
+
+	return equal(x, y)
+}
+
+func TestApply(t *testing.T) {
+	tests := []struct {
+		name  string
+		doc   string
+		patch string
+		want  string
+		err   error
+	}{
+		// RFC 6902 Appendix A
+		{
+			name:  "A.1 add an object member",
+			doc:   `{"foo": "bar"}`,
+			patch: `[{"op": "add", "path": "/baz", "value": "qux"}]`,
+			want:  `{"baz": "qux", "foo": "bar"}`,
+		},
+		{
+			name:  "A.2 add an array element",
+			doc:   `{"foo": ["bar", "baz"]}`,
+			patch: `[{"op": "add", "path": "/foo/1", "value": "qux"}]`,
+			want:  `{"foo": ["bar", "qux", "baz"]}`,
+		},
+		{
+			name:  "A.3 remove an object member",
+			doc:   `{"baz": "qux", "foo": "bar"}`,
+			patch: `[{"op": "remove", "path": "/baz"}]`,
+			want:  `{"foo": "bar"}`,
+		},
+		{
+			name:  "A.4 remove an array element",
+			doc:   `{"foo": ["bar", "qux", "baz"]}`,
+			patch: `[{"op": "remove", "path": "/foo/1"}]`,
+			want:  `{"foo": ["bar", "baz"]}`,
+		},
+		{
+			name:  "A.5 replace a value",
+			doc:   `{"baz": "qux", "foo": "bar"}`,
+			patch: `[{"op": "replace", "path": "/baz", "value": "boo"}]`,
+			want:  `{"baz": "boo", "foo": "bar"}`,
+		},
+		{
+			name:  "A.6 move a value",
+			doc:   `{"foo": {"bar": "baz", "waldo": "fred"}, "qux": {"corge": "grault"}}`,
+			patch: `[{"op": "move", "from": "/foo/waldo", "path": "/qux/thud"}]`,
+			want:  `{"foo": {"bar": "baz"}, "qux": {"corge": "grault", "thud": "fred"}}`,
+		},
+		{
+			name:  "A.7 move an array element",
+			doc:   `{"foo": ["all", "grass", "cows", "eat"]}`,
+			patch: `[{"op": "move", "from": "/foo/1", "path": "/foo/3"}]`,
+			want:  `{"foo": ["all", "cows", "eat", "grass"]}`,
+		},
+		{
+			name:  "A.8 test a value success",
+			doc:   `{"baz": "qux", "foo": ["a", 2, "c"]}`,
+			patch: `[{"op": "test", "path": "/baz", "value": "qux"}, {"op": "test", "path": "/foo/1", "value": 2}]`,
+			want:  `{"baz": "qux", "foo": ["a", 2, "c"]}`,
+		},
+		{
+			name:  "A.9 test a value error",
+			doc:   `{"baz": "qux"}`,
+			patch: `[{"op": "test", "path": "/baz", "value": "bar"}]`,
+			err:   ErrTestFailed,
+		},
+		{
+			name:  "A.10 add a nested member object",
+			doc:   `{"foo": "bar"}`,
+			patch: `[{"op": "add", "path": "/child", "value": {"grandchild": {}}}]`,
+			want:  `{"foo": "bar", "child": {"grandchild": {}}}`,
+		},
+		{
+			name:  "A.11 ignore unrecognized elements",
+			doc:   `{"foo": "bar"}`,
+			patch: `[{"op": "add", "path": "/baz", "value": "qux", "xyz": 123}]`,
+			want:  `{"foo": "bar", "baz": "qux"}`,
+		},
+		{
+			name:  "A.12 add to a nonexistent target",
+			doc:   `{"foo": "bar"}`,
+			patch: `[{"op": "add", "path": "/baz/bat", "value": "qux"}]`,
+			err:   ErrInvalidPath,
+		},
+		{
+			name:  "A.14 escape ordering",
+			doc:   `{"/": 9, "~1": 10}`,
+			patch: `[{"op": "test", "path": "/~01", "value": 10}]`,
+			want:  `{"/": 9, "~1": 10}`,
+		},
+		{
+			name:  "A.15 compare strings and numbers",
+			doc:   `{"/": 9, "~1": 10}`,
+			patch: `[{"op": "test", "path": "/~01", "value": "10"}]`,
+			err:   ErrTestFailed,
+		},
+		{
+			name:  "A.16 add an array value",
+			doc:   `{"foo": ["bar"]}`,
+			patch: `[{"op": "add", "path": "/foo/-", "value": ["abc", "def"]}]`,
+			want:  `{"foo": ["bar", ["abc", "def"]]}`,
+		},
+
+		// add
+		{
+			name:  "add replaces an existing member",
+			doc:   `{"foo": 1}`,
+			patch: `[{"op": "add", "path": "/foo", "value": 2}]`,
+			want:  `{"foo": 2}`,
+		},
+		{
+			name:  "add at the end of an array by index",
+			doc:   `[1, 2]`,
+			patch: `[{"op": "add", "path": "/2", "value": 3}]`,
+			want:  `[1, 2, 3]`,
+		},
+		{
+			name:  "add replaces the whole document",
+			doc:   `{"foo": 1}`,
+			patch: `[{"op": "add", "path": "", "value": [1]}]`,
+			want:  `[1]`,
+		},
+		{
+			name:  "add past the end of an array",
+			doc:   `[1, 2]`,
+			patch: `[{"op": "add", "path": "/3", "value": 3}]`,
+			err:   ErrInvalidPath,
+		},
+		{
+			name:  "add at a negative index",
+			doc:   `[1, 2]`,
+			patch: `[{"op": "add", "path": "/-1", "value": 3}]`,
+			err:   ErrInvalidPath,
+		},
+		{
+			name:  "add at an index with a leading zero",
+			doc:   `[1, 2]`,
+			patch: `[{"op": "add", "path": "/01", "value": 3}]`,
+			err:   ErrInvalidPath,
+		},
+		{
+			name:  "add into a string",
+			doc:   `{"foo": "bar"}`,
+			patch: `[{"op": "add", "path": "/foo/baz", "value": 1}]`,
+			err:   ErrInvalidPath,
+		},
+		{
+			name:  "add without a value",
+			doc:   `{}`,
+			patch: `[{"op": "add", "path": "/foo"}]`,
+			err:   ErrInvalidPatch,
+		},
+		{
+			name:  "add a null value",
+			doc:   `{}`,
+			patch: `[{"op": "add", "path": "/foo", "value": null}]`,
+			want:  `{"foo": null}`,
+		},
+
+		// remove
+		{
+			name:  "remove a missing member",
+			doc:   `{"foo": 1}`,
+			patch: `[{"op": "remove", "path": "/bar"}]`,
+			err:   ErrInvalidPath,
+		},
+		{
+			name:  "remove with the end of an array",
+			doc:   `[1, 2]`,
+			patch: `[{"op": "remove", "path": "/-"}]`,
+			err:   ErrInvalidPath,
+		},
+		{
+			name:  "remove past the end of an array",
+			doc:   `[1, 2]`,
+			patch: `[{"op": "remove", "path": "/2"}]`,
+			err:   ErrInvalidPath,
+		},
+
+		// replace
+		{
+			name:  "replace an array element",
+			doc:   `{"foo": [1, 2, 3]}`,
+			patch: `[{"op": "replace", "path": "/foo/1", "value": 5}]`,
+			want:  `{"foo": [1, 5, 3]}`,
+		},
+		{
+			name:  "replace the whole document",
+			doc:   `{"foo": 1}`,
+			patch: `[{"op": "replace", "path": "", "value": {"bar": 2}}]`,
+			want:  `{"bar": 2}`,
+		},
+		{
+			name:  "replace a missing member",
+			doc:   `{"foo": 1}`,
+			patch: `[{"op": "replace", "path": "/bar", "value": 2}]`,
+			err:   ErrInvalidPath,
+		},
+		{
+			name:  "replace without a value",
+			doc:   `{"foo": 1}`,
+			patch: `[{"op": "replace", "path": "/foo"}]`,
+			err:   ErrInvalidPatch,
+		},
+
+		// move
+		{
+			name:  "move to the same path",
+			doc:   `{"foo": {"bar": 1}}`,
+			patch: `[{"op": "move", "from": "/foo", "path": "/foo"}]`,
+			want:  `{"foo": {"bar": 1}}`,
+		},
+		{
+			name:  "move to a sibling sharing a prefix",
+			doc:   `{"foo": 1}`,
+			patch: `[{"op": "move", "from": "/foo", "path": "/foobar"}]`,
+			want:  `{"foobar": 1}`,
+		},
+		{
+			name:  "move into itself",
+			doc:   `{"foo": {"bar": 1}}`,
+			patch: `[{"op": "move", "from": "/foo", "path": "/foo/bar"}]`,
+			err:   ErrInvalidPath,
+		},
+		{
+			name:  "move a missing member",
+			doc:   `{"foo": 1}`,
+			patch: `[{"op": "move", "from": "/bar", "path": "/baz"}]`,
+			err:   ErrInvalidPath,
+		},
+		{
+			name:  "move without from",
+			doc:   `{"foo": 1}`,
+			patch: `[{"op": "move", "path": "/bar"}]`,
+			err:   ErrInvalidPatch,
+		},
+
+		// copy
+		{
+			name:  "copy a member",
+			doc:   `{"foo": {"bar": 1}}`,
+			patch: `[{"op": "copy", "from": "/foo", "path": "/baz"}]`,
+			want:  `{"foo": {"bar": 1}, "baz": {"bar": 1}}`,
+		},
+		{
+			name:  "copy is not shared with the original",
+			doc:   `{"foo": {"bar": 1}}`,
+			patch: `[{"op": "copy", "from": "/foo", "path": "/baz"}, {"op": "replace", "path": "/baz/bar", "value": 2}]`,
+			want:  `{"foo": {"bar": 1}, "baz": {"bar": 2}}`,
+		},
+		{
+			name:  "copy an array element to the end",
+			doc:   `[1, 2]`,
+			patch: `[{"op": "copy", "from": "/0", "path": "/-"}]`,
+			want:  `[1, 2, 1]`,
+		},
+		{
+			name:  "copy a missing member",
+			doc:   `{"foo": 1}`,
+			patch: `[{"op": "copy", "from": "/bar", "path": "/baz"}]`,
+			err:   ErrInvalidPath,
+		},
+
+		// test
+		{
+			name:  "test numbers by value",
+			doc:   `{"foo": 1}`,
+			patch: `[{"op": "test", "path": "/foo", "value": 1.0}]`,
+			want:  `{"foo": 1}`,
+		},
+		{
+			name:  "test objects regardless of member order",
+			doc:   `{"foo": {"a": 1, "b": [true, null]}}`,
+			patch: `[{"op": "test", "path": "/foo", "value": {"b": [true, null], "a": 1}}]`,
+			want:  `{"foo": {"a": 1, "b": [true, null]}}`,
+		},
+		{
+			name:  "test arrays by order",
+			doc:   `{"foo": [1, 2]}`,
+			patch: `[{"op": "test", "path": "/foo", "value": [2, 1]}]`,
+			err:   ErrTestFailed,
+		},
+		{
+			name:  "test an object with an extra member",
+			doc:   `{"foo": {"a": 1}}`,
+			patch: `[{"op": "test", "path": "/foo", "value": {"a": 1, "b": 2}}]`,
+			err:   ErrTestFailed,
+		},
+		{
+			name:  "test a missing member",
+			doc:   `{"foo": 1}`,
+			patch: `[{"op": "test", "path": "/bar", "value": 1}]`,
+			err:   ErrInvalidPath,
+		},
+		{
+			name:  "test the whole document",
+			doc:   `[1]`,
+			patch: `[{"op": "test", "path": "", "value": [1]}]`,
+			want:  `[1]`,
+		},
+
+		// patch documents
+		{
+			name:  "a failed operation fails the whole patch",
+			doc:   `{"foo": 1}`,
+			patch: `[{"op": "add", "path": "/bar", "value": 2}, {"op": "remove", "path": "/baz"}]`,
+			err:   ErrInvalidPath,
+		},
+		{
+			name:  "unknown op",
+			doc:   `{}`,
+			patch: `[{"op": "merge", "path": "/foo", "value": 1}]`,
+			err:   ErrInvalidPatch,
+		},
+		{
+			name:  "missing path",
+			doc:   `{}`,
+			patch: `[{"op": "add", "value": 1}]`,
+			err:   ErrInvalidPatch,
+		},
+		{
+			name:  "path without a leading slash",
+			doc:   `{"foo": 1}`,
+			patch: `[{"op": "remove", "path": "foo"}]`,
+			err:   ErrInvalidPath,
+		},
+		{
+			name:  "patch that isn't an array",
+			doc:   `{}`,
+			patch: `{"op": "add", "path": "/foo", "value": 1}`,
+			err:   ErrInvalidPatch,
+		},
+		{
+			name:  "empty patch",
+			doc:   `{"foo": 1}`,
+			patch: `[]`,
+			want:  `{"foo": 1}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Apply([]byte(tt.doc), []byte(tt.patch))
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("Apply() error = %v, want %v", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Apply() error = %v", err)
+			}
+			if !sameJSON(t, got, []byte(tt.want)) {
+				t.Errorf("Apply() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParsePointer(t *testing.T) {
+	tests := []struct {
+		pointer string
+		want    []string
+		err     bool
+	}{
+		{pointer: "", want: nil},
+		{pointer: "/", want: []string{""}},
+		{pointer: "/foo/0", want: []string{"foo", "0"}},
+		{pointer: "/a~1b", want: []string{"a/b"}},
+		{pointer: "/m~0n", want: []string{"m~n"}},
+		{pointer: "/~01", want: []string{"~1"}},
+		{pointer: "foo", err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pointer, func(t *testing.T) {
+			got, err := parsePointer(tt.pointer)
+			if tt.err {
+				if !errors.Is(err, ErrInvalidPath) {
+					t.Fatalf("parsePointer() error = %v, want %v", err, ErrInvalidPath)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parsePointer() error = %v", err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("parsePointer() = %q, want %q", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("parsePointer() = %q, want %q", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestMergePatch(t *testing.T) {
+	tests := []struct {
+		name  string
+		doc   string
+		patch string
+		want  string
+		err   error
+	}{
+		// RFC 7396 Appendix A
+		{name: "replace a member", doc: `{"a":"b"}`, patch: `{"a":"c"}`, want: `{"a":"c"}`},
+		{name: "add a member", doc: `{"a":"b"}`, patch: `{"b":"c"}`, want: `{"a":"b","b":"c"}`},
+		{name: "remove a member", doc: `{"a":"b"}`, patch: `{"a":null}`, want: `{}`},
+		{name: "remove one of two members", doc: `{"a":"b","b":"c"}`, patch: `{"a":null}`, want: `{"b":"c"}`},
+		{name: "replace an array", doc: `{"a":["b"]}`, patch: `{"a":"c"}`, want: `{"a":"c"}`},
+		{name: "replace with an array", doc: `{"a":"c"}`, patch: `{"a":["b"]}`, want: `{"a":["b"]}`},
+		{name: "merge nested objects", doc: `{"a":{"b":"c"}}`, patch: `{"a":{"b":"d","c":null}}`, want: `{"a":{"b":"d"}}`},
+		{name: "arrays are not merged", doc: `{"a":[{"b":"c"}]}`, patch: `{"a":[1]}`, want: `{"a":[1]}`},
+		{name: "array replaces an array", doc: `["a","b"]`, patch: `["c","d"]`, want: `["c","d"]`},
+		{name: "array replaces an object", doc: `{"a":"b"}`, patch: `["c"]`, want: `["c"]`},
+		{name: "null replaces the document", doc: `{"a":"foo"}`, patch: `null`, want: `null`},
+		{name: "string replaces the document", doc: `{"a":"foo"}`, patch: `"bar"`, want: `"bar"`},
+		{name: "null member of a new object is left out", doc: `{"e":null}`, patch: `{"a":1}`, want: `{"e":null,"a":1}`},
+		{name: "object replaces an array", doc: `[1,2]`, patch: `{"a":"b","c":null}`, want: `{"a":"b"}`},
+		{name: "nested nulls of a new member are left out", doc: `{}`, patch: `{"a":{"bb":{"ccc":null}}}`, want: `{"a":{"bb":{}}}`},
+
+		{name: "invalid patch", doc: `{}`, patch: `{"a":`, err: ErrInvalidPatch},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := MergePatch([]byte(tt.doc), []byte(tt.patch))
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("MergePatch() error = %v, want %v", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("MergePatch() error = %v", err)
+			}
+			if !sameJSON(t, got, []byte(tt.want)) {
+				t.Errorf("MergePatch() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		name string
+		a    string
+		b    string
+		want string
+	}{
+		{name: "same documents", a: `{"a":1}`, b: `{"a":1.0}`, want: `[]`},
+		{name: "member added", a: `{}`, b: `{"a":1}`, want: `[{"op":"add","path":"/a","value":1}]`},
+		{name: "member removed", a: `{"a":1}`, b: `{}`, want: `[{"op":"remove","path":"/a"}]`},
+		{name: "member replaced", a: `{"a":1}`, b: `{"a":"1"}`, want: `[{"op":"replace","path":"/a","value":"1"}]`},
+		{name: "member name escaped", a: `{}`, b: `{"a/~b":1}`, want: `[{"op":"add","path":"/a~1~0b","value":1}]`},
+		{name: "array grown", a: `[1]`, b: `[1,2,3]`, want: `[{"op":"add","path":"/1","value":2},{"op":"add","path":"/2","value":3}]`},
+		{name: "array shrunk", a: `[1,2,3]`, b: `[1]`, want: `[{"op":"remove","path":"/2"},{"op":"remove","path":"/1"}]`},
+		{name: "type changed", a: `{"a":[1]}`, b: `{"a":{"0":1}}`, want: `[{"op":"replace","path":"/a","value":{"0":1}}]`},
+		{name: "whole document replaced", a: `1`, b: `2`, want: `[{"op":"replace","path":"","value":2}]`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Diff([]byte(tt.a), []byte(tt.b))
+			if err != nil {
+				t.Fatalf("Diff() error = %v", err)
+			}
+			if !sameJSON(t, got, []byte(tt.want)) {
+				t.Errorf("Diff() = %s, want %s", got, tt.want)
+			}
+
+			// the diff turns a into b
+			patched, err := Apply([]byte(tt.a), got)
+			if err != nil {
+				t.Fatalf("Apply(Diff()) error = %v", err)
+			}
+			if !sameJSON(t, patched, []byte(tt.b)) {
+				t.Errorf("Apply(Diff()) = %s, want %s", patched, tt.b)
+			}
+		})
+	}
+}
@@ -1,60 +1,283 @@
 package main
 
 import (
+	"context"
+	"net/http"
 	"os"
+	"time"
 
 	env "github.com/caarlos0/env/v6"
 	"github.com/go-chi/chi"
 	"github.com/rekram1-node/httptemplate"
+	"github.com/rekram1-node/workout-backend/auth"
 	"github.com/rekram1-node/workout-backend/handlers"
 	"github.com/rekram1-node/workout-backend/middleware"
+	"github.com/rekram1-node/workout-backend/notify"
 	"github.com/rekram1-node/workout-backend/repository"
+	"github.com/rekram1-node/workout-backend/throttle"
+	"github.com/rekram1-node/workout-backend/volume"
 	"github.com/rs/zerolog"
 )
 
 type config struct {
-	PgURI     string `env:"PG_URI,required"`
-	JWTSecret string `env:"JWT_SECRET,required"`
+	PgURI string `env:"PG_URI,required"`
+
+	// JWT_SECRET is the legacy HS256 key, JWT_KEYS and JWT_KEY_FILE hold key
+	// sets with kids, see README for the format
+	JWTSecret   string        `env:"JWT_SECRET"`
+	JWTKeys     string        `env:"JWT_KEYS"`
+	JWTKeyFile  string        `env:"JWT_KEY_FILE"`
+	JWTKeyGrace time.Duration `env:"JWT_KEY_GRACE" envDefault:"24h"`
+
+	AccessTokenTTL  time.Duration `env:"ACCESS_TOKEN_TTL" envDefault:"15m"`
+	RefreshTokenTTL time.Duration `env:"REFRESH_TOKEN_TTL" envDefault:"720h"`
+
+	RevocationCacheTTL time.Duration `env:"REVOCATION_CACHE_TTL" envDefault:"30s"`
+
+	// users that are made admins on start up
+	AdminUsernames []string `env:"ADMIN_USERNAMES" envSeparator:","`
+
+	// lifetime of the tokens admins get to act as another user
+	ImpersonationTTL time.Duration `env:"IMPERSONATION_TTL" envDefault:"15m"`
+
+	TOTPIssuer string `env:"TOTP_ISSUER" envDefault:"workout-backend"`
+
+	// share of a set that counts for the secondary muscles of an exercise in
+	// volume analytics, between 0 and 1, volume.DefaultSecondaryCredit when
+	// not set
+	SecondaryMuscleCredit float64 `env:"SECONDARY_MUSCLE_CREDIT"`
+
+	// how long deleted mesos stay in the trash and deleted accounts can be
+	// restored before they are purged, every PURGE_INTERVAL
+	MesoRetention        time.Duration `env:"MESO_RETENTION" envDefault:"720h"`
+	AccountDeletionGrace time.Duration `env:"ACCOUNT_DELETION_GRACE" envDefault:"168h"`
+	PurgeInterval        time.Duration `env:"PURGE_INTERVAL" envDefault:"1h"`
+
+	PasswordResetTTL time.Duration `env:"PASSWORD_RESET_TTL" envDefault:"30m"`
+	// outbox stores messages in the outbox_messages table, log writes them to stdout
+	Notifier string `env:"NOTIFIER" envDefault:"outbox"`
+
+	// memory only works with a single instance, use postgres when running more
+	LoginThrottleStore   string        `env:"LOGIN_THROTTLE_STORE" envDefault:"memory"`
+	LoginUserMaxFailures int           `env:"LOGIN_USER_MAX_FAILURES" envDefault:"5"`
+	LoginIPMaxFailures   int           `env:"LOGIN_IP_MAX_FAILURES" envDefault:"50"`
+	LoginBackoffBase     time.Duration `env:"LOGIN_BACKOFF_BASE" envDefault:"1s"`
+	LoginBackoffMax      time.Duration `env:"LOGIN_BACKOFF_MAX" envDefault:"5m"`
+	LoginLockout         time.Duration `env:"LOGIN_LOCKOUT" envDefault:"15m"`
+	LoginFailureWindow   time.Duration `env:"LOGIN_FAILURE_WINDOW" envDefault:"1h"`
+
+	PasswordHashAlgorithm string `env:"PASSWORD_HASH_ALGORITHM" envDefault:"argon2id"`
+	Argon2Memory          uint32 `env:"ARGON2_MEMORY_KIB" envDefault:"65536"`
+	Argon2Iterations      uint32 `env:"ARGON2_ITERATIONS" envDefault:"3"`
+	Argon2Parallelism     uint8  `env:"ARGON2_PARALLELISM" envDefault:"2"`
+	BcryptCost            int    `env:"BCRYPT_COST" envDefault:"12"`
 }
 
 func main() {
-	cfg := config{}
+	cfg := config{SecondaryMuscleCredit: volume.DefaultSecondaryCredit}
 	logger := zerolog.New(os.Stdout)
 
 	if err := env.Parse(&cfg); err != nil {
 		logger.Fatal().Err(err).Msg("failed to read configuration")
 	}
+	if cfg.SecondaryMuscleCredit < 0 || cfg.SecondaryMuscleCredit > 1 {
+		logger.Fatal().Float64("secondary_muscle_credit", cfg.SecondaryMuscleCredit).Msg("SECONDARY_MUSCLE_CREDIT must be between 0 and 1")
+	}
+
+	argon2idHasher := auth.DefaultArgon2id
+	argon2idHasher.Memory = cfg.Argon2Memory
+	argon2idHasher.Iterations = cfg.Argon2Iterations
+	argon2idHasher.Parallelism = cfg.Argon2Parallelism
+	passwords, err := auth.NewPasswords(cfg.PasswordHashAlgorithm, argon2idHasher, auth.BcryptHasher{Cost: cfg.BcryptCost})
+	if err != nil {
+		logger.Fatal().Err(err).Msg("invalid password hashing configuration")
+	}
 
-	db, err := repository.New(cfg.PgURI)
+	db, err := repository.New(cfg.PgURI, passwords)
 	if err != nil {
 		logger.Fatal().Err(err).Msg("failed to connect to database")
 	}
 
+	if err := db.AssignRole(logger.WithContext(context.Background()), auth.RoleAdmin, cfg.AdminUsernames); err != nil {
+		logger.Fatal().Err(err).Msg("failed to assign admin role")
+	}
+
+	if cfg.MesoRetention <= 0 || cfg.AccountDeletionGrace <= 0 || cfg.PurgeInterval <= 0 {
+		logger.Fatal().
+			Dur("meso_retention", cfg.MesoRetention).
+			Dur("account_deletion_grace", cfg.AccountDeletionGrace).
+			Dur("purge_interval", cfg.PurgeInterval).
+			Msg("MESO_RETENTION, ACCOUNT_DELETION_GRACE and PURGE_INTERVAL must be positive")
+	}
+	go purgeDeleted(logger.WithContext(context.Background()), db, cfg)
+
 	app, err := httptemplate.New("workout-backend")
 	if err != nil {
 		logger.Fatal().Err(err).Msg("failed to create template application")
 	}
 
+	var notifier notify.Notifier
+	switch cfg.Notifier {
+	case "outbox":
+		notifier = notify.OutboxNotifier{Store: db}
+	case "log":
+		notifier = notify.LogNotifier{}
+	default:
+		logger.Fatal().Str("notifier", cfg.Notifier).Msg("unknown notifier")
+	}
+
+	loginPolicy := throttle.Policy{
+		MaxFailures: cfg.LoginUserMaxFailures,
+		BaseDelay:   cfg.LoginBackoffBase,
+		MaxDelay:    cfg.LoginBackoffMax,
+		Lockout:     cfg.LoginLockout,
+		Window:      cfg.LoginFailureWindow,
+	}
+	ipPolicy := loginPolicy
+	ipPolicy.MaxFailures = cfg.LoginIPMaxFailures
+	limiter := &throttle.Limiter{
+		Username: loginPolicy,
+		IP:       ipPolicy,
+	}
+	switch cfg.LoginThrottleStore {
+	case "memory":
+		limiter.Store = throttle.NewMemoryStore(cfg.LoginFailureWindow + cfg.LoginLockout)
+	case "postgres":
+		limiter.Store = db.ThrottleStore()
+	default:
+		logger.Fatal().Str("store", cfg.LoginThrottleStore).Msg("unknown login throttle store")
+	}
+
+	keyring, err := auth.LoadKeyring(cfg.JWTSecret, cfg.JWTKeys, cfg.JWTKeyFile, cfg.JWTKeyGrace)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("failed to load signing keys")
+	}
+
+	tokens := auth.TokenConfig{
+		Keyring:         keyring,
+		AccessTokenTTL:  cfg.AccessTokenTTL,
+		RefreshTokenTTL: cfg.RefreshTokenTTL,
+	}
+
+	revocations := middleware.NewRevocationCache(db, cfg.RevocationCacheTTL)
 	jwt := &middleware.JWTAuthentication{
-		SecretKey: cfg.JWTSecret,
+		Keyring:              keyring,
+		Revocations:          revocations,
+		PersonalAccessTokens: db,
 	}
+	scoped := func(scope string) []func(http.Handler) http.Handler {
+		return []func(http.Handler) http.Handler{jwt.Authentication, middleware.RequireScope(scope)}
+	}
+	coaches := append(scoped(auth.ScopeMesoWrite), middleware.RequireRole(auth.RoleCoach, auth.RoleAdmin))
 
+	app.Router.Get("/.well-known/jwks.json", handlers.JWKSRead(keyring))
 	app.Router.Route("/client-services", func(r chi.Router) {
 		r.Route("/user", func(usr chi.Router) {
-			usr.Post("/signin", handlers.LoginHandler(db, cfg.JWTSecret))
-			usr.Post("/", handlers.UserCreate(db, cfg.JWTSecret))
-			usr.With(jwt.Authentication).Get("/", handlers.UserRead(db))
-			usr.With(jwt.Authentication).Put("/", handlers.UserUpdate(db))
-			usr.With(jwt.Authentication).Delete("/", handlers.UserDelete(db))
+			usr.Post("/signin", handlers.LoginHandler(db, db, tokens, limiter))
+			usr.Post("/signin/mfa", handlers.LoginMFA(db, db, db, revocations, tokens, limiter))
+			usr.Post("/token/refresh", handlers.TokenRefresh(db, tokens))
+			usr.With(scoped(auth.ScopeAccount)...).Post("/signout", handlers.UserSignout(revocations))
+			usr.With(scoped(auth.ScopeAccount)...).Post("/signout-all", handlers.UserSignoutAll(revocations))
+			usr.Post("/", handlers.UserCreate(db, db, tokens))
+			usr.With(scoped(auth.ScopeUserRead)...).Get("/", handlers.UserRead(db))
+			usr.With(scoped(auth.ScopeUserWrite)...).Put("/", handlers.UserUpdate(db))
+			usr.With(scoped(auth.ScopeAccount)...).Delete("/", handlers.UserDelete(db, cfg.AccountDeletionGrace))
+			usr.Post("/undo-delete", handlers.UserUndoDelete(db, limiter, cfg.AccountDeletionGrace))
+			usr.With(scoped(auth.ScopeAccount)...).Put("/password", handlers.PasswordChange(db, revocations))
+			usr.Post("/password/forgot", handlers.PasswordForgot(db, notifier, cfg.PasswordResetTTL))
+			usr.Post("/password/reset", handlers.PasswordReset(db, revocations))
+			usr.With(scoped(auth.ScopeAccount)...).Post("/mfa/totp", handlers.MFAEnroll(db, cfg.TOTPIssuer))
+			usr.With(scoped(auth.ScopeAccount)...).Post("/mfa/totp/confirm", handlers.MFAConfirm(db))
+			usr.With(scoped(auth.ScopeAccount)...).Delete("/mfa/totp", handlers.MFADisable(db))
+			usr.With(scoped(auth.ScopeAccount)...).Post("/mfa/recovery-codes", handlers.MFARecoveryCodes(db))
+			usr.With(scoped(auth.ScopeAccount)...).Post("/tokens", handlers.PersonalAccessTokenCreate(db))
+			usr.With(scoped(auth.ScopeAccount)...).Get("/tokens", handlers.PersonalAccessTokensRead(db))
+			usr.With(scoped(auth.ScopeAccount)...).Delete("/tokens/{id}", handlers.PersonalAccessTokenDelete(db))
+			usr.With(scoped(auth.ScopeAccount)...).Get("/sessions", handlers.SessionsRead(db))
+			usr.With(scoped(auth.ScopeAccount)...).Delete("/sessions/{id}", handlers.SessionDelete(revocations))
+			usr.With(scoped(auth.ScopeUserRead)...).Get("/landmarks", handlers.VolumeLandmarksRead(db))
+			usr.With(scoped(auth.ScopeUserWrite)...).Put("/landmarks", handlers.VolumeLandmarksUpdate(db))
+		})
+		r.Route("/admin", func(admin chi.Router) {
+			admin.Use(jwt.Authentication, middleware.RequireScope(auth.ScopeAdmin), middleware.RequireRole(auth.RoleAdmin))
+			admin.Get("/users", handlers.AdminUsersSearch(db))
+			admin.Get("/users/{id}", handlers.AdminUserRead(db))
+			admin.Post("/users/{id}/suspend", handlers.AdminUserSuspend(db, revocations))
+			admin.Post("/users/{id}/unsuspend", handlers.AdminUserUnsuspend(db))
+			admin.Post("/users/{id}/password-reset", handlers.AdminUserPasswordReset(db, db, revocations, notifier, cfg.PasswordResetTTL))
+			admin.Post("/users/{id}/restore", handlers.AdminUserRestore(db))
+			admin.Put("/users/{id}/role", handlers.AdminUserRole(db, revocations))
+			admin.Post("/users/{id}/impersonate", handlers.AdminImpersonate(db, keyring, cfg.ImpersonationTTL))
 		})
 		r.Route("/meso", func(meso chi.Router) {
-			meso.With(jwt.Authentication).Post("/", handlers.MesoCreate(db))
-			meso.With(jwt.Authentication).Get("/", handlers.MesoRead(db))
-			meso.With(jwt.Authentication).Get("/top", handlers.MesosRead(db))
-			meso.With(jwt.Authentication).Put("/", handlers.UpdateMeso(db))
-			meso.With(jwt.Authentication).Delete("/", handlers.DeleteMeso(db))
+			meso.With(scoped(auth.ScopeMesoWrite)...).Post("/", handlers.MesoCreate(db))
+			meso.With(scoped(auth.ScopeMesoRead)...).Get("/", handlers.MesoRead(db))
+			meso.With(scoped(auth.ScopeMesoRead)...).Get("/top", handlers.MesosRead(db))
+			meso.With(scoped(auth.ScopeMesoRead)...).Get("/trash", handlers.MesoTrashRead(db, cfg.MesoRetention))
+			meso.With(scoped(auth.ScopeMesoWrite)...).Post("/{uuid}/restore", handlers.MesoRestore(db))
+			meso.With(scoped(auth.ScopeMesoWrite)...).Put("/", handlers.UpdateMeso(db))
+			meso.With(scoped(auth.ScopeMesoWrite)...).Patch("/", handlers.UpdateMeso(db))
+			meso.With(scoped(auth.ScopeMesoWrite)...).Delete("/", handlers.DeleteMeso(db))
+			meso.With(scoped(auth.ScopeMesoWrite)...).Post("/week/complete", handlers.WeekComplete(db))
+			meso.With(scoped(auth.ScopeMesoRead)...).Get("/week/suggestions", handlers.WeekSuggestions(db))
+			meso.With(scoped(auth.ScopeMesoRead)...).Get("/{uuid}/volume", handlers.MesoVolume(db, cfg.SecondaryMuscleCredit))
+			meso.With(scoped(auth.ScopeMesoRead)...).Get("/{uuid}/revisions", handlers.MesoRevisionsRead(db))
+			meso.With(scoped(auth.ScopeMesoRead)...).Get("/{uuid}/revisions/diff", handlers.MesoRevisionsDiff(db))
+			meso.With(scoped(auth.ScopeMesoRead)...).Get("/{uuid}/revisions/{version}", handlers.MesoRevisionRead(db))
+			meso.With(scoped(auth.ScopeMesoWrite)...).Post("/{uuid}/revisions/{version}/restore", handlers.MesoRevisionRestore(db))
+			meso.With(scoped(auth.ScopeMesoWrite)...).Post("/{uuid}/weeks", handlers.WeekInsert(db))
+			meso.Route("/{uuid}/weeks/{week}", func(week chi.Router) {
+				week.With(scoped(auth.ScopeMesoRead)...).Get("/", handlers.WeekRead(db))
+				week.With(scoped(auth.ScopeMesoWrite)...).Put("/", handlers.WeekReplace(db))
+				week.With(scoped(auth.ScopeMesoWrite)...).Patch("/", handlers.WeekPatch(db))
+				week.With(scoped(auth.ScopeMesoWrite)...).Delete("/", handlers.WeekDelete(db))
+				week.With(scoped(auth.ScopeMesoRead)...).Get("/days/{day}", handlers.DayRead(db))
+				week.With(scoped(auth.ScopeMesoWrite)...).Put("/days/{day}", handlers.DayReplace(db))
+				week.With(scoped(auth.ScopeMesoWrite)...).Patch("/days/{day}", handlers.DayPatch(db))
+				week.With(scoped(auth.ScopeMesoWrite)...).Delete("/days/{day}", handlers.DayDelete(db))
+				week.With(scoped(auth.ScopeMesoWrite)...).Post("/days/{day}/lifts", handlers.LiftInsert(db))
+				week.With(scoped(auth.ScopeMesoWrite)...).Post("/days/{day}/lifts/reorder", handlers.LiftsReorder(db))
+				week.With(scoped(auth.ScopeMesoRead)...).Get("/days/{day}/lifts/{lift}", handlers.LiftRead(db))
+				week.With(scoped(auth.ScopeMesoWrite)...).Put("/days/{day}/lifts/{lift}", handlers.LiftReplace(db))
+				week.With(scoped(auth.ScopeMesoWrite)...).Patch("/days/{day}/lifts/{lift}", handlers.LiftPatch(db))
+				week.With(scoped(auth.ScopeMesoWrite)...).Delete("/days/{day}/lifts/{lift}", handlers.LiftDelete(db))
+				week.With(scoped(auth.ScopeMesoWrite)...).Put("/days/{day}/lifts/{lift}/sets/{set}", handlers.SetLog(db))
+			})
+		})
+		r.Route("/exercises", func(exercise chi.Router) {
+			exercise.With(scoped(auth.ScopeMesoRead)...).Get("/", handlers.ExercisesRead(db))
+			exercise.With(scoped(auth.ScopeMesoRead)...).Get("/{id}", handlers.ExerciseRead(db))
+			exercise.With(scoped(auth.ScopeMesoWrite)...).Post("/", handlers.ExerciseCreate(db))
+			exercise.With(scoped(auth.ScopeMesoWrite)...).Put("/{id}", handlers.ExerciseUpdate(db))
+			exercise.With(scoped(auth.ScopeMesoWrite)...).Delete("/{id}", handlers.ExerciseDelete(db))
+			exercise.With(coaches...).Post("/global", handlers.GlobalExerciseCreate(db))
+			exercise.With(coaches...).Put("/global/{id}", handlers.GlobalExerciseUpdate(db))
+			exercise.With(scoped(auth.ScopeMesoRead)...).Get("/{id}/records", handlers.ExerciseRecordsRead(db))
+			exercise.With(scoped(auth.ScopeMesoRead)...).Get("/{id}/history", handlers.ExerciseHistory(db))
+		})
+		r.Route("/records", func(records chi.Router) {
+			records.With(scoped(auth.ScopeMesoRead)...).Get("/", handlers.PersonalRecordsRead(db))
 		})
 	})
 
 	app.Start()
 }
+
+// purgeDeleted hard deletes the mesos and accounts that have been deleted for
+// longer than they are kept, every PurgeInterval
+func purgeDeleted(ctx context.Context, db *repository.Repository, cfg config) {
+	ticker := time.NewTicker(cfg.PurgeInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := db.PurgeDeleted(ctx, cfg.MesoRetention, cfg.AccountDeletionGrace); err != nil {
+			zerolog.Ctx(ctx).Error().Err(err).Msg("failed to purge deleted mesos and accounts")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
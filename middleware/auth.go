@@ -9,8 +9,12 @@ import (
 	"github.com/rs/zerolog"
 )
 
+// JWTAuthentication authenticates requests with a JWT access token or, when
+// PersonalAccessTokens is set, a personal access token.
 type JWTAuthentication struct {
-	SecretKey string
+	Keyring              *auth.Keyring
+	Revocations          RevocationChecker
+	PersonalAccessTokens PersonalAccessTokenAuthenticator
 }
 
 func (jwtAuth JWTAuthentication) Authentication(h http.Handler) http.Handler {
@@ -29,7 +33,12 @@ func (jwtAuth JWTAuthentication) Authentication(h http.Handler) http.Handler {
 		}
 
 		authToken := t[1]
-		authorized, err := auth.IsAuthorized(authToken, jwtAuth.SecretKey)
+		if auth.IsPersonalAccessToken(authToken) {
+			jwtAuth.personalAccessToken(h, w, r, authToken)
+			return
+		}
+
+		claims, err := auth.ParseToken(authToken, jwtAuth.Keyring, auth.PurposeAccess)
 		if err != nil {
 			logger.Info().Err(err).Msg("unathorized or failed to read token")
 			w.WriteHeader(http.StatusUnauthorized)
@@ -39,35 +48,58 @@ func (jwtAuth JWTAuthentication) Authentication(h http.Handler) http.Handler {
 			return
 		}
 
-		if !authorized {
-			logger.Info().Err(err).Msg("unathorized token")
+		if claims.UUID == "" {
+			logger.Info().Msg("missing uuid")
 			w.WriteHeader(http.StatusUnauthorized)
 			_ = json.NewEncoder(w).Encode(map[string]string{
-				"error": "unathorized or invalid token",
+				"error": "missing uuid in claims",
 			})
 			return
 		}
 
-		uuid, err := auth.ReadUUIDFromToken(authToken, jwtAuth.SecretKey)
+		principal := &auth.Principal{
+			UserUUID:  claims.UUID,
+			Username:  claims.Name,
+			Role:      claims.Role,
+			TokenID:   claims.ID,
+			Scopes:    claims.Scopes,
+			Method:    auth.AuthMethodJWT,
+			SessionID: claims.SessionID,
+			IssuedAt:  claims.IssuedAt.Time,
+			ExpiresAt: claims.ExpiresAt.Time,
+		}
+
+		if claims.Actor != nil {
+			principal.ActorUUID = claims.Actor.Subject
+		}
+
+		// tokens signed before roles existed carry neither
+		if principal.Role == "" {
+			principal.Role = auth.RoleUser
+		}
+		if len(principal.Scopes) == 0 {
+			principal.Scopes = auth.ScopesForRole(auth.RoleUser)
+		}
+
+		revoked, err := jwtAuth.Revocations.IsTokenRevoked(ctx, principal)
 		if err != nil {
-			logger.Info().Err(err).Msg("failed to read token")
-			w.WriteHeader(http.StatusUnauthorized)
+			logger.Error().Err(err).Msg("failed to check token revocation")
+			w.WriteHeader(http.StatusInternalServerError)
 			_ = json.NewEncoder(w).Encode(map[string]string{
-				"error": err.Error(),
+				"error": "unable to verify token",
 			})
 			return
 		}
 
-		if uuid == "" {
-			logger.Info().Msg("missing uuid")
+		if revoked {
+			logger.Info().Str("token_id", claims.ID).Msg("revoked token")
 			w.WriteHeader(http.StatusUnauthorized)
 			_ = json.NewEncoder(w).Encode(map[string]string{
-				"error": "missing uuid in claims",
+				"error": "token has been revoked",
 			})
 			return
 		}
 
-		r.Header.Set("UUID", uuid)
-		h.ServeHTTP(w, r)
+		h.ServeHTTP(w, r.WithContext(auth.WithPrincipal(ctx, principal)))
 	})
 }
@@ -0,0 +1,66 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/rekram1-node/workout-backend/auth"
+	"github.com/rs/zerolog"
+)
+
+// RequireScope only lets requests through whose principal has scope. It goes
+// after the authentication middleware, e.g. r.With(jwt.Authentication,
+// middleware.RequireScope(auth.ScopeMesoRead)).
+func RequireScope(scope string) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			principal, ok := auth.PrincipalFromContext(r.Context())
+			if !ok {
+				w.WriteHeader(http.StatusUnauthorized)
+				_ = json.NewEncoder(w).Encode(map[string]string{
+					"error": "unauthenticated",
+				})
+				return
+			}
+
+			if !principal.HasScope(scope) {
+				zerolog.Ctx(r.Context()).Info().Str("scope", scope).Msg("token is missing scope")
+				w.WriteHeader(http.StatusForbidden)
+				_ = json.NewEncoder(w).Encode(map[string]string{
+					"error": "token is missing the " + scope + " scope",
+				})
+				return
+			}
+
+			h.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireRole only lets requests through whose principal has one of roles.
+// Like RequireScope it goes after the authentication middleware.
+func RequireRole(roles ...string) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			principal, ok := auth.PrincipalFromContext(r.Context())
+			if !ok {
+				w.WriteHeader(http.StatusUnauthorized)
+				_ = json.NewEncoder(w).Encode(map[string]string{
+					"error": "unauthenticated",
+				})
+				return
+			}
+
+			if !principal.HasRole(roles...) {
+				zerolog.Ctx(r.Context()).Info().Str("role", principal.Role).Msg("principal is missing role")
+				w.WriteHeader(http.StatusForbidden)
+				_ = json.NewEncoder(w).Encode(map[string]string{
+					"error": "not allowed",
+				})
+				return
+			}
+
+			h.ServeHTTP(w, r)
+		})
+	}
+}
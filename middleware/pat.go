@@ -0,0 +1,47 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/rekram1-node/workout-backend/auth"
+	"github.com/rs/zerolog"
+)
+
+type PersonalAccessTokenAuthenticator interface {
+	AuthenticatePersonalAccessToken(ctx context.Context, tokenHash string) (*auth.Principal, error)
+}
+
+func (jwtAuth JWTAuthentication) personalAccessToken(h http.Handler, w http.ResponseWriter, r *http.Request, token string) {
+	ctx := r.Context()
+	logger := zerolog.Ctx(ctx)
+	if jwtAuth.PersonalAccessTokens == nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"error": "personal access tokens are not accepted here",
+		})
+		return
+	}
+
+	principal, err := jwtAuth.PersonalAccessTokens.AuthenticatePersonalAccessToken(ctx, auth.HashOpaqueToken(token))
+	switch {
+	case errors.Is(err, auth.ErrPersonalAccessTokenInvalid):
+		logger.Info().Msg("invalid personal access token")
+		w.WriteHeader(http.StatusUnauthorized)
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"error": err.Error(),
+		})
+		return
+	case err != nil:
+		logger.Error().Err(err).Msg("failed to check personal access token")
+		w.WriteHeader(http.StatusInternalServerError)
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"error": "unable to verify token",
+		})
+		return
+	}
+
+	h.ServeHTTP(w, r.WithContext(auth.WithPrincipal(ctx, principal)))
+}
@@ -0,0 +1,151 @@
+package middleware
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/rekram1-node/workout-backend/auth"
+)
+
+type RevocationChecker interface {
+	IsTokenRevoked(ctx context.Context, principal *auth.Principal) (bool, error)
+}
+
+type RevocationStore interface {
+	RevocationChecker
+	RevokeAccessToken(ctx context.Context, userUUID, tokenID string, expiresAt time.Time) error
+	RevokeSession(ctx context.Context, userUUID, sessionUUID string) error
+	RevokeOtherSessions(ctx context.Context, userUUID, keepSessionUUID string) error
+	RevokeAllTokens(ctx context.Context, userUUID string) error
+}
+
+type revocationEntry struct {
+	userUUID  string
+	sessionID string
+	revoked   bool
+	expiresAt time.Time
+}
+
+// RevocationCache sits in front of a RevocationStore so that checking a token
+// does not cost a database round trip on every request. Revocations made
+// through the cache apply immediately on this instance, revocations made by
+// other instances are picked up once the cached answer is older than TTL.
+type RevocationCache struct {
+	store RevocationStore
+	ttl   time.Duration
+
+	mu        sync.Mutex
+	entries   map[string]revocationEntry
+	lastSweep time.Time
+}
+
+func NewRevocationCache(store RevocationStore, ttl time.Duration) *RevocationCache {
+	return &RevocationCache{
+		store:   store,
+		ttl:     ttl,
+		entries: make(map[string]revocationEntry),
+	}
+}
+
+func (c *RevocationCache) IsTokenRevoked(ctx context.Context, principal *auth.Principal) (bool, error) {
+	now := time.Now()
+	c.mu.Lock()
+	entry, ok := c.entries[principal.TokenID]
+	c.mu.Unlock()
+	if ok && now.Before(entry.expiresAt) {
+		return entry.revoked, nil
+	}
+
+	revoked, err := c.store.IsTokenRevoked(ctx, principal)
+	if err != nil {
+		return false, err
+	}
+
+	c.set(principal.TokenID, revocationEntry{
+		userUUID:  principal.UserUUID,
+		sessionID: principal.SessionID,
+		revoked:   revoked,
+		expiresAt: now.Add(c.ttl),
+	})
+
+	return revoked, nil
+}
+
+func (c *RevocationCache) RevokeAccessToken(ctx context.Context, userUUID, tokenID string, expiresAt time.Time) error {
+	if err := c.store.RevokeAccessToken(ctx, userUUID, tokenID, expiresAt); err != nil {
+		return err
+	}
+
+	c.set(tokenID, revocationEntry{
+		userUUID:  userUUID,
+		revoked:   true,
+		expiresAt: expiresAt,
+	})
+
+	return nil
+}
+
+func (c *RevocationCache) RevokeSession(ctx context.Context, userUUID, sessionUUID string) error {
+	if err := c.store.RevokeSession(ctx, userUUID, sessionUUID); err != nil {
+		return err
+	}
+
+	c.forget(func(entry revocationEntry) bool {
+		return entry.sessionID == sessionUUID
+	})
+
+	return nil
+}
+
+func (c *RevocationCache) RevokeOtherSessions(ctx context.Context, userUUID, keepSessionUUID string) error {
+	if err := c.store.RevokeOtherSessions(ctx, userUUID, keepSessionUUID); err != nil {
+		return err
+	}
+
+	c.forget(func(entry revocationEntry) bool {
+		return entry.userUUID == userUUID && entry.sessionID != keepSessionUUID
+	})
+
+	return nil
+}
+
+func (c *RevocationCache) RevokeAllTokens(ctx context.Context, userUUID string) error {
+	if err := c.store.RevokeAllTokens(ctx, userUUID); err != nil {
+		return err
+	}
+
+	c.forget(func(entry revocationEntry) bool {
+		return entry.userUUID == userUUID
+	})
+
+	return nil
+}
+
+// forget drops cached answers so the next check goes to the store
+func (c *RevocationCache) forget(match func(revocationEntry) bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for tokenID, entry := range c.entries {
+		if match(entry) {
+			delete(c.entries, tokenID)
+		}
+	}
+}
+
+func (c *RevocationCache) set(tokenID string, entry revocationEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[tokenID] = entry
+
+	// sweep stale entries every so often so the map doesn't grow unbounded
+	now := time.Now()
+	if now.Sub(c.lastSweep) > c.ttl {
+		c.lastSweep = now
+		for id, e := range c.entries {
+			if now.After(e.expiresAt) {
+				delete(c.entries, id)
+			}
+		}
+	}
+}
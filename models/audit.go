@@ -0,0 +1,13 @@
+package models
+
+import "gorm.io/gorm"
+
+// AuditEvent records an action an admin took on a user account
+type AuditEvent struct {
+	gorm.Model `json:"-"`
+	ActorUUID  string `gorm:"index:idx_audit_event_actor_uuid;not null"`
+	TargetUUID string `gorm:"index:idx_audit_event_target_uuid"`
+	Action     string `gorm:"not null"`
+	Detail     string ``
+	IP         string ``
+}
@@ -0,0 +1,26 @@
+package models
+
+import "gorm.io/gorm"
+
+// Exercise is an entry of the exercise catalog. Global entries are seeded and
+// have no user, custom entries belong to the user that made them.
+type Exercise struct {
+	gorm.Model `json:"-"`
+	UUID       string `json:"id" gorm:"index:idx_exercise_uuid,unique;not null"`
+	UserID     *uint  `json:"-" gorm:"index:idx_exercise_user_id"`
+	UserUUID   string `json:"-"`
+	Name       string `json:"name" gorm:"not null"`
+
+	PrimaryMuscles   []string `json:"primary_muscles" gorm:"type:jsonb;serializer:json"`
+	SecondaryMuscles []string `json:"secondary_muscles" gorm:"type:jsonb;serializer:json"`
+	Equipment        string   `json:"equipment"`
+	Movement         string   `json:"movement"`
+	Unilateral       bool     `json:"unilateral"`
+	Aliases          []string `json:"aliases" gorm:"type:jsonb;serializer:json"`
+	Custom           bool     `json:"custom" gorm:"-"`
+}
+
+func (e *Exercise) AfterFind(tx *gorm.DB) error {
+	e.Custom = e.UserID != nil
+	return nil
+}
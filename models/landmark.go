@@ -0,0 +1,15 @@
+package models
+
+import "gorm.io/gorm"
+
+// VolumeLandmark holds the weekly sets of a muscle group a user needs to
+// grow (MEV), grows best with (MAV) and can recover from (MRV)
+type VolumeLandmark struct {
+	gorm.Model `json:"-"`
+	UserID     uint   `json:"-" gorm:"index:idx_landmark_user_muscle,unique"`
+	UserUUID   string `json:"-"`
+	Muscle     string `json:"muscle" gorm:"index:idx_landmark_user_muscle,unique;not null"`
+	MEV        int    `json:"mev"`
+	MAV        int    `json:"mav"`
+	MRV        int    `json:"mrv"`
+}
@@ -0,0 +1,25 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// LoginAttempt is the audit trail of failed sign ins
+type LoginAttempt struct {
+	gorm.Model `json:"-"`
+	Username   string `gorm:"index:idx_login_attempt_username"`
+	IP         string `gorm:"index:idx_login_attempt_ip"`
+	UserAgent  string
+	Reason     string
+}
+
+// LoginThrottle is the shared throttle state when several instances run
+type LoginThrottle struct {
+	Key         string `gorm:"primaryKey"`
+	Failures    int
+	LastFailure time.Time
+	LockedUntil time.Time
+	UpdatedAt   time.Time
+}
@@ -1,6 +1,8 @@
 package models
 
 import (
+	"time"
+
 	"gorm.io/gorm"
 )
 
@@ -13,11 +15,23 @@ type Meso struct {
 	Name       string `gorm:"not null"`
 
 	Weeks *[]Week `gorm:"type:jsonb;serializer:json" validate:"required"`
+	// RIRSchedule is the reps in reserve target of each week, weeks get their
+	// TargetRIR from it when the meso is created
+	RIRSchedule []int `gorm:"type:jsonb;serializer:json"`
+	// Version goes up by one with every change, clients send it back as an
+	// ETag so they don't overwrite changes they haven't seen
+	Version int `gorm:"not null;default:1"`
 }
 
 type Week struct {
 	gorm.Model `gorm:"constraint:OnDelete:CASCADE" json:"-"`
 	MesoID     uint `gorm:"index:idx_meso_id"`
+	// Number is the 1 based position of the week in the meso
+	Number      int
+	Deload      bool
+	CompletedAt *time.Time
+	// TargetRIR is how many reps in reserve sets should be left with this week
+	TargetRIR *int
 
 	Monday, Tuesday, Wednesday, Thursday, Friday, Saturday, Sunday *Day `gorm:"foreignKey:WeekID;constraint:OnDelete:CASCADE" validate:"required"`
 }
@@ -33,10 +47,77 @@ type Lift struct {
 	DayID      uint `gorm:"index:idx_week_id"`
 
 	// Info for a lift
-	Exercise string  `json:"exercise" validate:"required"`
-	Sets     int     `json:"sets"`
-	Weight   float32 `json:"weight"`
-	Reps     int     `json:"reps"`
-	Pump     int     `json:"pump"`
-	Soreness int     `json:"soreness"`
+	Exercise string `json:"exercise" validate:"required"`
+	// ExerciseID is the UUID of the catalog entry, set from the name when it
+	// isn't given
+	ExerciseID string `json:"exercise_id,omitempty"`
+	Sets       []Set  `json:"sets"`
+	Pump       int    `json:"pump"`
+	Soreness   int    `json:"soreness"`
+	// TargetRIR or TargetRPE override the effort target of the week for
+	// every set of the lift
+	TargetRIR *int     `json:"target_rir,omitempty"`
+	TargetRPE *float32 `json:"target_rpe,omitempty"`
+
+	// Progression names the rule used to set next week's targets, see the
+	// progression package. MinReps and MaxReps are the rep range for double
+	// progression, Increment is the load step.
+	Progression string  `json:"progression,omitempty"`
+	MinReps     int     `json:"min_reps,omitempty"`
+	MaxReps     int     `json:"max_reps,omitempty"`
+	Increment   float32 `json:"increment,omitempty"`
+}
+
+// Weekdays are the names of the days of a week from Monday to Sunday, in the
+// order Days returns them
+var Weekdays = []string{"monday", "tuesday", "wednesday", "thursday", "friday", "saturday", "sunday"}
+
+// Days returns the days of the week from Monday to Sunday
+func (w *Week) Days() []*Day {
+	return []*Day{w.Monday, w.Tuesday, w.Wednesday, w.Thursday, w.Friday, w.Saturday, w.Sunday}
+}
+
+// Day returns the day named by one of Weekdays, nil when the week has no
+// such day
+func (w *Week) Day(name string) *Day {
+	for i, weekday := range Weekdays {
+		if weekday == name {
+			return w.Days()[i]
+		}
+	}
+
+	return nil
+}
+
+// SetDay replaces the day named by one of Weekdays, it reports false when
+// there is no such day
+func (w *Week) SetDay(name string, day *Day) bool {
+	days := []**Day{&w.Monday, &w.Tuesday, &w.Wednesday, &w.Thursday, &w.Friday, &w.Saturday, &w.Sunday}
+	for i, weekday := range Weekdays {
+		if weekday == name {
+			*days[i] = day
+			return true
+		}
+	}
+
+	return false
+}
+
+// Copy returns a deep copy of the day so its lifts can be logged on their own
+func (d *Day) Copy() *Day {
+	if d == nil {
+		return nil
+	}
+
+	day := &Day{}
+	if d.Lifts != nil {
+		lifts := make([]Lift, len(*d.Lifts))
+		copy(lifts, *d.Lifts)
+		for i := range lifts {
+			lifts[i].Sets = append([]Set(nil), lifts[i].Sets...)
+		}
+		day.Lifts = &lifts
+	}
+
+	return day
 }
@@ -0,0 +1,9 @@
+package models
+
+import "time"
+
+// Migration records a one off data migration that has been applied
+type Migration struct {
+	Name      string `gorm:"primaryKey"`
+	CreatedAt time.Time
+}
@@ -0,0 +1,15 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type OutboxMessage struct {
+	gorm.Model `json:"-"`
+	Recipient  string `gorm:"not null"`
+	Subject    string
+	Body       string
+	SentAt     *time.Time `gorm:"index:idx_outbox_sent_at"`
+}
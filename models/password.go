@@ -0,0 +1,27 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// PasswordResetToken is a single use, time limited token sent to a user who
+// forgot their password. Only its hash is stored.
+type PasswordResetToken struct {
+	gorm.Model `json:"-"`
+	UserID     uint   `gorm:"index:idx_password_reset_user_id"`
+	UserUUID   string ``
+	TokenHash  string `gorm:"index:idx_password_reset_token_hash,unique;not null"`
+	ExpiresAt  time.Time
+	UsedAt     *time.Time
+}
+
+// RecoveryCode is a single use code that stands in for a TOTP code when the
+// user has lost their authenticator. Only its hash is stored.
+type RecoveryCode struct {
+	gorm.Model `json:"-"`
+	UserID     uint   `gorm:"index:idx_recovery_code_user_id"`
+	CodeHash   string `gorm:"not null"`
+	UsedAt     *time.Time
+}
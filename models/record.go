@@ -0,0 +1,31 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// PersonalRecord is a best a user set on an exercise. Every record that was
+// beaten is kept as history, the current one is the latest of its kind.
+type PersonalRecord struct {
+	gorm.Model `json:"-"`
+	UUID       string `json:"id" gorm:"index:idx_record_uuid,unique"`
+	UserID     uint   `json:"-" gorm:"index:idx_record_user_exercise"`
+	UserUUID   string `json:"-"`
+	ExerciseID string `json:"exercise_id" gorm:"index:idx_record_user_exercise;not null"`
+	Exercise   string `json:"exercise"`
+	// Kind is e1rm, rep_max or session_volume, Reps is the rep count of a
+	// rep_max record
+	Kind  string  `json:"kind" gorm:"not null"`
+	Reps  int     `json:"reps,omitempty"`
+	Value float32 `json:"value"`
+	// Formula the e1RM was estimated with
+	Formula string `json:"formula,omitempty"`
+
+	// where the record was set
+	MesoUUID   string    `json:"meso_uuid"`
+	Week       int       `json:"week"`
+	Day        string    `json:"day"`
+	AchievedAt time.Time `json:"achieved_at"`
+}
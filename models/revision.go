@@ -0,0 +1,27 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// MesoRevision is a meso as one of its versions left it. Revisions are only
+// ever added, so any version can be read back, compared and restored.
+type MesoRevision struct {
+	ID       uint   `gorm:"primarykey" json:"-"`
+	MesoID   uint   `gorm:"index:idx_revision_meso_version,unique" json:"-"`
+	MesoUUID string `json:"meso_uuid"`
+	Version  int    `gorm:"index:idx_revision_meso_version,unique" json:"version"`
+	// AuthorUUID is the user who made the change, ActorUUID the admin
+	// impersonating them, if any
+	AuthorUUID string    `json:"author_uuid"`
+	ActorUUID  string    `json:"actor_uuid,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	// Diff is the JSON Patch from the previous version to this one, the first
+	// revision has the patch from an empty meso
+	Diff json.RawMessage `gorm:"type:jsonb;serializer:json" json:"diff"`
+
+	Name        string  `json:"-"`
+	Weeks       *[]Week `gorm:"type:jsonb;serializer:json" json:"-"`
+	RIRSchedule []int   `gorm:"type:jsonb;serializer:json" json:"-"`
+}
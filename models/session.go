@@ -0,0 +1,23 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Session is created by every sign in. Its UUID is the family ID of the
+// refresh tokens issued for it and the sid claim of its access tokens, so
+// revoking a session invalidates both.
+type Session struct {
+	gorm.Model  `json:"-"`
+	UserID      uint   `gorm:"index:idx_session_user_id"`
+	UserUUID    string `gorm:"index:idx_session_user_uuid"`
+	UUID        string `gorm:"index:idx_session_uuid,unique;not null"`
+	DeviceLabel string
+	UserAgent   string
+	IP          string
+	LastUsedAt  time.Time
+	ExpiresAt   time.Time
+	RevokedAt   *time.Time
+}
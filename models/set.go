@@ -0,0 +1,74 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"time"
+)
+
+// Set is one set of a lift, the targets are what was planned and the rest is
+// what was actually done.
+type Set struct {
+	TargetWeight float32 `json:"target_weight"`
+	TargetReps   int     `json:"target_reps"`
+	// TargetRIR or TargetRPE override the effort target of the lift and week
+	TargetRIR *int     `json:"target_rir,omitempty"`
+	TargetRPE *float32 `json:"target_rpe,omitempty"`
+
+	Weight float32 `json:"weight"`
+	Reps   int     `json:"reps"`
+	// RIR (reps in reserve) and RPE are optional, nil when not logged
+	RIR         *int       `json:"rir,omitempty"`
+	RPE         *float32   `json:"rpe,omitempty"`
+	Completed   bool       `json:"completed"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+}
+
+// UnmarshalJSON also reads lifts from before per set logging, where sets was
+// a count with a single weight and reps for the lift. Those are expanded into
+// that many identical sets.
+func (l *Lift) UnmarshalJSON(data []byte) error {
+	type lift Lift
+	var raw struct {
+		lift
+		Sets json.RawMessage `json:"sets"`
+
+		Weight       float32 `json:"weight"`
+		Reps         int     `json:"reps"`
+		TargetSets   int     `json:"target_sets"`
+		TargetWeight float32 `json:"target_weight"`
+		TargetReps   int     `json:"target_reps"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*l = Lift(raw.lift)
+
+	sets := bytes.TrimSpace(raw.Sets)
+	if len(sets) > 0 && sets[0] == '[' {
+		return json.Unmarshal(sets, &l.Sets)
+	}
+
+	var count int
+	if len(sets) > 0 && !bytes.Equal(sets, []byte("null")) {
+		if err := json.Unmarshal(sets, &count); err != nil {
+			return err
+		}
+	}
+	if raw.TargetSets > count {
+		count = raw.TargetSets
+	}
+
+	l.Sets = make([]Set, count)
+	for i := range l.Sets {
+		l.Sets[i] = Set{
+			TargetWeight: raw.TargetWeight,
+			TargetReps:   raw.TargetReps,
+			Weight:       raw.Weight,
+			Reps:         raw.Reps,
+			Completed:    raw.Reps > 0,
+		}
+	}
+
+	return nil
+}
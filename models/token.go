@@ -0,0 +1,47 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// RefreshToken is a server side record of an opaque refresh token. Every
+// rotation creates a new token in the same family, presenting a rotated token
+// again revokes the whole family. The family ID is the UUID of the session.
+type RefreshToken struct {
+	gorm.Model `json:"-"`
+	UserID     uint   `gorm:"index:idx_refresh_token_user_id"`
+	UserUUID   string `gorm:"index:idx_refresh_token_user_uuid"`
+	FamilyID   string `gorm:"index:idx_refresh_token_family_id;not null"`
+	TokenHash  string `gorm:"index:idx_refresh_token_hash,unique;not null"`
+	ExpiresAt  time.Time
+	RotatedAt  *time.Time
+	RevokedAt  *time.Time
+}
+
+// RevokedToken records an access token that was revoked before it expired.
+// Rows can be purged once ExpiresAt has passed.
+type RevokedToken struct {
+	gorm.Model `json:"-"`
+	UserUUID   string    `gorm:"index:idx_revoked_token_user_uuid"`
+	TokenID    string    `gorm:"index:idx_revoked_token_id,unique;not null"`
+	ExpiresAt  time.Time `gorm:"index:idx_revoked_token_expires_at"`
+}
+
+// PersonalAccessToken is a long lived token a user creates for scripts and
+// integrations. Only the hash of the token is stored, Prefix keeps its first
+// few characters so it can be recognised in listings.
+type PersonalAccessToken struct {
+	gorm.Model `json:"-"`
+	UUID       string     `gorm:"index:idx_personal_access_token_uuid,unique;not null"`
+	UserID     uint       `gorm:"index:idx_personal_access_token_user_id"`
+	UserUUID   string     `gorm:"index:idx_personal_access_token_user_uuid"`
+	Name       string     `gorm:"not null"`
+	Prefix     string     ``
+	TokenHash  string     `gorm:"index:idx_personal_access_token_hash,unique;not null"`
+	Scopes     []string   `gorm:"type:jsonb;serializer:json"`
+	ExpiresAt  *time.Time ``
+	LastUsedAt *time.Time ``
+	RevokedAt  *time.Time ``
+}
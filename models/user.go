@@ -1,6 +1,8 @@
 package models
 
 import (
+	"time"
+
 	"gorm.io/gorm"
 )
 
@@ -9,8 +11,26 @@ type User struct {
 	gorm.Model `gorm:"constraint:OnDelete:CASCADE" json:"-"`
 	UUID       string `gorm:"index:idx_user_uuid,unique"`
 	Username   string `json:"username" gorm:"uniqueIndex;not null"`
-	Password   string `json:"password" gorm:"not null"`
+	Password   string `json:"-" gorm:"not null"`
+	Role       string `json:"role" gorm:"not null;default:user"`
+
+	// Access tokens issued at or before this time are rejected
+	TokensRevokedAt *time.Time `json:"-"`
+
+	// Set by admins, a suspended user can't sign in
+	SuspendedAt     *time.Time `json:"-"`
+	SuspendedReason string     `json:"-"`
+	// Sign in is refused until the password has been reset
+	PasswordResetRequired bool `json:"-" gorm:"not null;default:false"`
+
+	// Two factor authentication, TOTPSecret is set on enrollment and only
+	// enforced once the user confirmed it with a code
+	MFAEnabled   bool   `json:"mfa_enabled" gorm:"not null;default:false"`
+	TOTPSecret   string `json:"-"`
+	TOTPLastStep int64  `json:"-"`
 
 	// User tracking/exercise info
 	Mesos []*Meso `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE"`
+	// E1RMFormula is how one rep maxes are estimated, see the strength package
+	E1RMFormula string `json:"e1rm_formula" gorm:"not null;default:epley"`
 }
@@ -0,0 +1,46 @@
+package notify
+
+import (
+	"context"
+
+	"github.com/rs/zerolog"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Notifier delivers messages to users, e.g. password reset codes
+type Notifier interface {
+	Notify(ctx context.Context, msg Message) error
+}
+
+// LogNotifier writes messages to the request logger. It is meant for local
+// development only, the full message (including any codes) is logged.
+type LogNotifier struct{}
+
+func (LogNotifier) Notify(ctx context.Context, msg Message) error {
+	zerolog.Ctx(ctx).Info().
+		Str("to", msg.To).
+		Str("subject", msg.Subject).
+		Str("body", msg.Body).
+		Msg("notification")
+
+	return nil
+}
+
+type OutboxStore interface {
+	EnqueueOutboxMessage(ctx context.Context, recipient, subject, body string) error
+}
+
+// OutboxNotifier stores messages in the outbox table for a separate sender
+// (or an operator) to deliver, so no mail server is needed to run the API.
+type OutboxNotifier struct {
+	Store OutboxStore
+}
+
+func (n OutboxNotifier) Notify(ctx context.Context, msg Message) error {
+	return n.Store.EnqueueOutboxMessage(ctx, msg.To, msg.Subject, msg.Body)
+}
@@ -0,0 +1,132 @@
+package progression
+
+import (
+	"math"
+
+	"github.com/rekram1-node/workout-backend/models"
+)
+
+const (
+	// RIRTolerance is how far logged RIR can be from the target before a
+	// load change is suggested
+	RIRTolerance float32 = 1
+	// loadPerRIR is roughly how much load one rep in reserve is worth
+	loadPerRIR float32 = 0.025
+)
+
+// Suggestion is a load change for the next session of a lift whose logged
+// effort was off target
+type Suggestion struct {
+	Day             string  `json:"day"`
+	Exercise        string  `json:"exercise"`
+	TargetRIR       float32 `json:"target_rir"`
+	LoggedRIR       float32 `json:"logged_rir"`
+	Weight          float32 `json:"weight"`
+	SuggestedWeight float32 `json:"suggested_weight"`
+}
+
+// Suggestions returns a suggestion for every lift of the week whose logged
+// RIR, averaged over its sets, is more than RIRTolerance from the target
+func Suggestions(week *models.Week) []Suggestion {
+	suggestions := []Suggestion{}
+	for i, day := range week.Days() {
+		if day == nil || day.Lifts == nil {
+			continue
+		}
+		for _, lift := range *day.Lifts {
+			if suggestion, ok := Suggest(week, lift); ok {
+				suggestion.Day = models.Weekdays[i]
+				suggestions = append(suggestions, suggestion)
+			}
+		}
+	}
+
+	return suggestions
+}
+
+// Suggest compares the effort logged for the completed sets of lift with
+// their targets, more reps in reserve than planned means the load can go up
+// and fewer means it should come down.
+func Suggest(week *models.Week, lift models.Lift) (Suggestion, bool) {
+	var target, logged, weight float32
+	var count int
+	for _, set := range lift.Sets {
+		want, ok := targetRIR(week, lift, set)
+		if !ok || !set.Completed {
+			continue
+		}
+		got, ok := loggedRIR(set)
+		if !ok {
+			continue
+		}
+
+		target += want
+		logged += got
+		if set.Weight > weight {
+			weight = set.Weight
+		}
+		count++
+	}
+	if count == 0 || weight == 0 {
+		return Suggestion{}, false
+	}
+
+	target /= float32(count)
+	logged /= float32(count)
+	off := logged - target
+	if float32(math.Abs(float64(off))) <= RIRTolerance {
+		return Suggestion{}, false
+	}
+
+	step := increment(lift)
+	suggested := weight * (1 + off*loadPerRIR)
+	suggested = float32(math.Round(float64(suggested/step))) * step
+	if suggested == weight {
+		if off > 0 {
+			suggested += step
+		} else {
+			suggested -= step
+		}
+	}
+	if suggested < 0 {
+		suggested = 0
+	}
+
+	return Suggestion{
+		Exercise:        lift.Exercise,
+		TargetRIR:       target,
+		LoggedRIR:       logged,
+		Weight:          weight,
+		SuggestedWeight: suggested,
+	}, true
+}
+
+// targetRIR is the effort target of a set, the set's own target wins over the
+// lift's which wins over the week's. RPE targets are turned into RIR.
+func targetRIR(week *models.Week, lift models.Lift, set models.Set) (float32, bool) {
+	switch {
+	case set.TargetRIR != nil:
+		return float32(*set.TargetRIR), true
+	case set.TargetRPE != nil:
+		return 10 - *set.TargetRPE, true
+	case lift.TargetRIR != nil:
+		return float32(*lift.TargetRIR), true
+	case lift.TargetRPE != nil:
+		return 10 - *lift.TargetRPE, true
+	case week != nil && week.TargetRIR != nil:
+		return float32(*week.TargetRIR), true
+	}
+
+	return 0, false
+}
+
+func loggedRIR(set models.Set) (float32, bool) {
+	switch {
+	case set.RIR != nil:
+		return float32(*set.RIR), true
+	case set.RPE != nil:
+		return 10 - *set.RPE, true
+	}
+
+	return 0, false
+}
@@ -0,0 +1,172 @@
+// Package progression works out next week's targets for a lift from what was
+// logged this week.
+//
+// Pump and soreness are logged on a 1 to 3 scale, 0 meaning not logged. For
+// pump 1 is barely any and 3 is a great pump, for soreness 1 means it healed
+// well before the next session and 3 means still sore when it came around.
+package progression
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/rekram1-node/workout-backend/models"
+)
+
+const (
+	Linear = "linear"
+	Double = "double"
+	Volume = "rp_volume"
+
+	// Default is used for lifts that don't name a rule
+	Default = Volume
+
+	// DefaultIncrement is the load step when a lift doesn't set one
+	DefaultIncrement float32 = 2.5
+)
+
+var ErrUnknownRule = errors.New("unknown progression rule")
+
+// Target is the prescription for a lift
+type Target struct {
+	Sets   int
+	Weight float32
+	Reps   int
+}
+
+// Rule computes the next target of a lift from the logged lift
+type Rule interface {
+	Next(lift models.Lift) Target
+}
+
+// RuleFunc lets a plain function be used as a Rule
+type RuleFunc func(lift models.Lift) Target
+
+func (f RuleFunc) Next(lift models.Lift) Target {
+	return f(lift)
+}
+
+var (
+	mu    sync.RWMutex
+	rules = map[string]Rule{
+		Linear: RuleFunc(linear),
+		Double: RuleFunc(double),
+		Volume: RuleFunc(volume),
+	}
+)
+
+// Register adds a rule lifts can name in their progression, registering a
+// name again replaces the rule.
+func Register(name string, rule Rule) {
+	mu.Lock()
+	defer mu.Unlock()
+	rules[name] = rule
+}
+
+// Lookup returns the rule registered under name, an empty name is Default
+func Lookup(name string) (Rule, error) {
+	if name == "" {
+		name = Default
+	}
+
+	mu.RLock()
+	defer mu.RUnlock()
+	rule, ok := rules[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownRule, name)
+	}
+
+	return rule, nil
+}
+
+// Rules returns the names of every registered rule
+func Rules() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	names := make([]string, 0, len(rules))
+	for name := range rules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// NextWeek sets the targets of every lift in next from the matching lift
+// logged in done. Lifts are matched by day and exercise, lifts that only
+// exist in one of the weeks or have no sets in done are left alone. When the
+// logged effort was off target the load follows Suggest instead of the rule.
+// Deload weeks keep the load but only get half the sets.
+func NextWeek(done, next *models.Week) error {
+	nextDays := next.Days()
+	for i, doneDay := range done.Days() {
+		nextDay := nextDays[i]
+		if doneDay == nil || doneDay.Lifts == nil || nextDay == nil || nextDay.Lifts == nil {
+			continue
+		}
+
+		used := make([]bool, len(*nextDay.Lifts))
+		for _, lift := range *doneDay.Lifts {
+			j := matchLift(*nextDay.Lifts, used, &lift)
+			if j < 0 {
+				continue
+			}
+			used[j] = true
+			// there is nothing to progress from, and a target of no sets
+			// would wipe out the sets planned for next week
+			if len(lift.Sets) == 0 {
+				continue
+			}
+
+			rule, err := Lookup(lift.Progression)
+			if err != nil {
+				return err
+			}
+
+			target := rule.Next(lift)
+			if suggestion, ok := Suggest(done, lift); ok {
+				target.Weight = suggestion.SuggestedWeight
+			}
+			if next.Deload {
+				target = deload(lift)
+			}
+
+			applyTarget(&(*nextDay.Lifts)[j], target)
+		}
+	}
+
+	return nil
+}
+
+// applyTarget gives the lift target.Sets sets with the target load and reps,
+// anything already logged in the sets that are kept stays as it is
+func applyTarget(lift *models.Lift, target Target) {
+	sets := make([]models.Set, target.Sets)
+	copy(sets, lift.Sets)
+	for i := range sets {
+		sets[i].TargetWeight = target.Weight
+		sets[i].TargetReps = target.Reps
+	}
+	lift.Sets = sets
+}
+
+// matchLift finds the first unused lift of the same exercise, by catalog ID
+// when both lifts have one and by name otherwise
+func matchLift(lifts []models.Lift, used []bool, done *models.Lift) int {
+	for i, lift := range lifts {
+		if used[i] {
+			continue
+		}
+		if lift.ExerciseID != "" && done.ExerciseID != "" {
+			if lift.ExerciseID == done.ExerciseID {
+				return i
+			}
+		} else if lift.Exercise == done.Exercise {
+			return i
+		}
+	}
+
+	return -1
+}
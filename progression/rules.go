@@ -0,0 +1,126 @@
+package progression
+
+import "github.com/rekram1-node/workout-backend/models"
+
+// planned is what the lift was meant to be this week, taken from the targets
+// of its first set and falling back to what was logged for sets that never had
+// targets
+func planned(lift models.Lift) Target {
+	target := Target{Sets: len(lift.Sets)}
+	if len(lift.Sets) == 0 {
+		return target
+	}
+
+	first := lift.Sets[0]
+	target.Weight, target.Reps = first.TargetWeight, first.TargetReps
+	if target.Weight == 0 {
+		target.Weight = first.Weight
+	}
+	if target.Reps == 0 {
+		target.Reps = first.Reps
+	}
+
+	return target
+}
+
+// lowestReps is the fewest reps done in a completed set, 0 when no set was
+// completed
+func lowestReps(lift models.Lift) int {
+	lowest := 0
+	for _, set := range lift.Sets {
+		if set.Completed && (lowest == 0 || set.Reps < lowest) {
+			lowest = set.Reps
+		}
+	}
+
+	return lowest
+}
+
+func increment(lift models.Lift) float32 {
+	if lift.Increment > 0 {
+		return lift.Increment
+	}
+
+	return DefaultIncrement
+}
+
+// repsHit is true when every set was completed with at least its target reps
+func repsHit(lift models.Lift) bool {
+	if len(lift.Sets) == 0 {
+		return false
+	}
+
+	for _, set := range lift.Sets {
+		target := set.TargetReps
+		if target == 0 {
+			target = set.Reps
+		}
+		if !set.Completed || set.Reps == 0 || set.Reps < target {
+			return false
+		}
+	}
+
+	return true
+}
+
+// linear adds load whenever the reps were hit and repeats the week otherwise
+func linear(lift models.Lift) Target {
+	target := planned(lift)
+	if repsHit(lift) {
+		target.Weight += increment(lift)
+	}
+
+	return target
+}
+
+// double works up the rep range at the same load, once every set reaches the
+// top of the range the load goes up and the reps start again from the bottom.
+// Lifts without a rep range progress like linear.
+func double(lift models.Lift) Target {
+	if lift.MinReps <= 0 || lift.MaxReps < lift.MinReps {
+		return linear(lift)
+	}
+
+	target := planned(lift)
+	lowest := lowestReps(lift)
+	switch {
+	case repsHit(lift) && lowest >= lift.MaxReps:
+		target.Weight += increment(lift)
+		target.Reps = lift.MinReps
+	case repsHit(lift):
+		target.Reps = lowest + 1
+	}
+
+	return target
+}
+
+// volume ramps sets up week to week based on how the muscle responded, sets
+// are added when the pump was poor, soreness healed in time and the reps were
+// still hit, and taken away when it was still sore. Load goes up like linear.
+func volume(lift models.Lift) Target {
+	target := linear(lift)
+	switch {
+	case lift.Soreness >= 3:
+		target.Sets--
+	case lift.Soreness == 0 || lift.Pump == 0 || !repsHit(lift):
+	case lift.Soreness == 1 && lift.Pump == 1:
+		target.Sets += 2
+	case lift.Pump < 3:
+		target.Sets++
+	}
+	if target.Sets < 1 {
+		target.Sets = 1
+	}
+
+	return target
+}
+
+// deload keeps the load and reps with half the sets
+func deload(lift models.Lift) Target {
+	target := planned(lift)
+	if target.Sets > 1 {
+		target.Sets /= 2
+	}
+
+	return target
+}
@@ -0,0 +1,293 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/rekram1-node/workout-backend/models"
+	"gorm.io/gorm"
+)
+
+const (
+	UserStatusActive    = "active"
+	UserStatusSuspended = "suspended"
+	UserStatusDeleted   = "deleted"
+
+	AuditSuspend       = "suspend"
+	AuditUnsuspend     = "unsuspend"
+	AuditPasswordReset = "password_reset"
+	AuditRestore       = "restore"
+	AuditRoleChange    = "role_change"
+	AuditImpersonate   = "impersonate"
+)
+
+const maxAdminUserPerPage = 100
+
+var ErrUserNotDeleted = errors.New("user is not deleted")
+
+type AdminUserQuery struct {
+	Query   string
+	Status  string
+	Page    int
+	PerPage int
+}
+
+type AdminUserResponse struct {
+	ID                    string     `json:"id"`
+	Username              string     `json:"username"`
+	Role                  string     `json:"role"`
+	MFAEnabled            bool       `json:"mfa_enabled"`
+	PasswordResetRequired bool       `json:"password_reset_required"`
+	SuspendedAt           *time.Time `json:"suspended_at"`
+	SuspendedReason       string     `json:"suspended_reason,omitempty"`
+	CreatedAt             time.Time  `json:"created_at"`
+	DeletedAt             *time.Time `json:"deleted_at"`
+}
+
+type AdminUserPage struct {
+	Users   []AdminUserResponse `json:"users"`
+	Page    int                 `json:"page"`
+	PerPage int                 `json:"per_page"`
+	Total   int64               `json:"total"`
+}
+
+type AdminUserStats struct {
+	AdminUserResponse
+	MesoCount      int64      `json:"meso_count"`
+	ActiveSessions int64      `json:"active_sessions"`
+	LastSignIn     *time.Time `json:"last_sign_in"`
+	LastActivity   *time.Time `json:"last_activity"`
+}
+
+func newAdminUserResponse(user *models.User) AdminUserResponse {
+	res := AdminUserResponse{
+		ID:                    user.UUID,
+		Username:              user.Username,
+		Role:                  user.Role,
+		MFAEnabled:            user.MFAEnabled,
+		PasswordResetRequired: user.PasswordResetRequired,
+		SuspendedAt:           user.SuspendedAt,
+		SuspendedReason:       user.SuspendedReason,
+		CreatedAt:             user.CreatedAt,
+	}
+	if user.DeletedAt.Valid {
+		res.DeletedAt = &user.DeletedAt.Time
+	}
+
+	return res
+}
+
+// SearchUsers pages through users whose username contains the query, deleted
+// users are only included when asked for by status.
+func (repo *Repository) SearchUsers(ctx context.Context, query AdminUserQuery) (*AdminUserPage, error) {
+	gormDB, logger := getDBLogger(repo, ctx, READ, "")
+	if query.Page < 1 {
+		query.Page = 1
+	}
+	if query.PerPage < 1 || query.PerPage > maxAdminUserPerPage {
+		query.PerPage = maxAdminUserPerPage
+	}
+
+	tx := gormDB.Model(&models.User{})
+	switch query.Status {
+	case UserStatusActive:
+		tx = tx.Where("suspended_at IS NULL")
+	case UserStatusSuspended:
+		tx = tx.Where("suspended_at IS NOT NULL")
+	case UserStatusDeleted:
+		tx = tx.Unscoped().Where("deleted_at IS NOT NULL")
+	}
+	if query.Query != "" {
+		escaped := strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(query.Query)
+		tx = tx.Where("username ILIKE ?", "%"+escaped+"%")
+	}
+	// the conditions are shared by the count and the page
+	tx = tx.Session(&gorm.Session{})
+
+	var total int64
+	if res := tx.Count(&total); res.Error != nil {
+		logger.Error().Err(res.Error).Msg("failed to count users")
+		return nil, res.Error
+	}
+
+	var users []models.User
+	res := tx.Order("id").
+		Offset((query.Page - 1) * query.PerPage).
+		Limit(query.PerPage).
+		Find(&users)
+	if res.Error != nil {
+		logger.Error().Err(res.Error).Msg("failed to search users")
+		return nil, res.Error
+	}
+
+	page := &AdminUserPage{
+		Users:   []AdminUserResponse{},
+		Page:    query.Page,
+		PerPage: query.PerPage,
+		Total:   total,
+	}
+	for i := range users {
+		page.Users = append(page.Users, newAdminUserResponse(&users[i]))
+	}
+
+	return page, nil
+}
+
+// ReadUserStats looks up any user, deleted ones included, along with a
+// summary of their activity.
+func (repo *Repository) ReadUserStats(ctx context.Context, userUUID string) (*AdminUserStats, error) {
+	gormDB, logger := getDBLogger(repo, ctx, READ, userUUID)
+	var user *models.User
+	res := gormDB.Unscoped().Where("uuid = ?", userUUID).Find(&user)
+	if err := checkDBError(res); err != nil {
+		logger.Info().Err(err).Msg("unable to find user")
+		return nil, err
+	}
+
+	stats := &AdminUserStats{AdminUserResponse: newAdminUserResponse(user)}
+	res = gormDB.Model(&models.Meso{}).Where("user_id = ?", user.ID).Count(&stats.MesoCount)
+	if res.Error != nil {
+		logger.Error().Err(res.Error).Msg("failed to count mesos")
+		return nil, res.Error
+	}
+
+	res = gormDB.Model(&models.Session{}).
+		Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", user.ID, time.Now()).
+		Count(&stats.ActiveSessions)
+	if res.Error != nil {
+		logger.Error().Err(res.Error).Msg("failed to count sessions")
+		return nil, res.Error
+	}
+
+	var sessionActivity struct {
+		LastSignIn   *time.Time
+		LastActivity *time.Time
+	}
+	res = gormDB.Model(&models.Session{}).
+		Select("MAX(created_at) AS last_sign_in, MAX(last_used_at) AS last_activity").
+		Where("user_id = ?", user.ID).
+		Scan(&sessionActivity)
+	if res.Error != nil {
+		logger.Error().Err(res.Error).Msg("failed to read session activity")
+		return nil, res.Error
+	}
+	stats.LastSignIn = sessionActivity.LastSignIn
+	stats.LastActivity = sessionActivity.LastActivity
+
+	var tokenActivity *time.Time
+	res = gormDB.Model(&models.PersonalAccessToken{}).
+		Select("MAX(last_used_at)").
+		Where("user_id = ?", user.ID).
+		Scan(&tokenActivity)
+	if res.Error != nil {
+		logger.Error().Err(res.Error).Msg("failed to read token activity")
+		return nil, res.Error
+	}
+	if tokenActivity != nil && (stats.LastActivity == nil || tokenActivity.After(*stats.LastActivity)) {
+		stats.LastActivity = tokenActivity
+	}
+
+	return stats, nil
+}
+
+func (repo *Repository) SuspendUser(ctx context.Context, userUUID, reason string) error {
+	gormDB, logger := getDBLogger(repo, ctx, UPDATE, userUUID)
+	res := gormDB.Model(&models.User{}).
+		Where("uuid = ?", userUUID).
+		Updates(map[string]interface{}{
+			"suspended_at":     time.Now(),
+			"suspended_reason": reason,
+		})
+	if err := checkDBError(res); err != nil {
+		logger.Info().Err(err).Msg("failed to suspend user")
+		return err
+	}
+
+	return nil
+}
+
+func (repo *Repository) UnsuspendUser(ctx context.Context, userUUID string) error {
+	gormDB, logger := getDBLogger(repo, ctx, UPDATE, userUUID)
+	res := gormDB.Model(&models.User{}).
+		Where("uuid = ?", userUUID).
+		Updates(map[string]interface{}{
+			"suspended_at":     nil,
+			"suspended_reason": "",
+		})
+	if err := checkDBError(res); err != nil {
+		logger.Info().Err(err).Msg("failed to unsuspend user")
+		return err
+	}
+
+	return nil
+}
+
+// RequirePasswordReset refuses sign in for the user until their password has
+// been reset, the user is returned so a reset can be sent to them.
+func (repo *Repository) RequirePasswordReset(ctx context.Context, userUUID string) (*models.User, error) {
+	gormDB, logger := getDBLogger(repo, ctx, UPDATE, userUUID)
+	var user *models.User
+	res := gormDB.Where("uuid = ?", userUUID).Find(&user)
+	if err := checkDBError(res); err != nil {
+		logger.Info().Err(err).Msg("unable to find user")
+		return nil, err
+	}
+
+	res = gormDB.Model(user).Update("password_reset_required", true)
+	if err := checkDBError(res); err != nil {
+		logger.Error().Err(err).Msg("failed to require password reset")
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// RestoreUser undoes the deletion of a user along with the mesos that were
+// deleted with them.
+func (repo *Repository) RestoreUser(ctx context.Context, userUUID string) error {
+	gormDB, logger := getDBLogger(repo, ctx, UPDATE, userUUID)
+	dberr := gormDB.Transaction(func(tx *gorm.DB) error {
+		var user *models.User
+		res := tx.Unscoped().Where("uuid = ?", userUUID).Find(&user)
+		if err := checkDBError(res); err != nil {
+			return err
+		}
+		if !user.DeletedAt.Valid {
+			return ErrUserNotDeleted
+		}
+
+		return restoreUser(tx, user)
+	})
+
+	if dberr != nil {
+		logger.Info().Err(dberr).Msg("failed to restore user")
+		return dberr
+	}
+
+	return nil
+}
+
+func (repo *Repository) SetUserRole(ctx context.Context, userUUID, role string) error {
+	gormDB, logger := getDBLogger(repo, ctx, UPDATE, userUUID)
+	res := gormDB.Model(&models.User{}).
+		Where("uuid = ?", userUUID).
+		Update("role", role)
+	if err := checkDBError(res); err != nil {
+		logger.Info().Err(err).Msg("failed to set user role")
+		return err
+	}
+
+	return nil
+}
+
+func (repo *Repository) RecordAuditEvent(ctx context.Context, event *models.AuditEvent) error {
+	gormDB, logger := getDBLogger(repo, ctx, CREATE, event.TargetUUID)
+	if err := checkDBError(gormDB.Create(event)); err != nil {
+		logger.Error().Err(err).Str("action", event.Action).Msg("failed to record audit event")
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,249 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/rekram1-node/workout-backend/catalog"
+	"github.com/rekram1-node/workout-backend/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var ErrUnknownExercise = errors.New("unknown exercise id")
+
+type ExerciseQuery struct {
+	Query     string
+	Muscle    string
+	Equipment string
+}
+
+type ExerciseRequest struct {
+	UserUUID         string   `json:"-"`
+	Name             string   `json:"name" validate:"required,max=128"`
+	PrimaryMuscles   []string `json:"primary_muscles" validate:"required,min=1,dive,muscle"`
+	SecondaryMuscles []string `json:"secondary_muscles" validate:"dive,muscle"`
+	Equipment        string   `json:"equipment" validate:"omitempty,equipment"`
+	Movement         string   `json:"movement" validate:"omitempty,movement"`
+	Unilateral       bool     `json:"unilateral"`
+	Aliases          []string `json:"aliases" validate:"max=16,dive,required,max=128"`
+}
+
+// visibleExercises scopes tx to the global catalog and the custom exercises
+// of the user
+func visibleExercises(tx *gorm.DB, userUUID string) *gorm.DB {
+	return tx.Where("user_id IS NULL OR user_uuid = ?", userUUID)
+}
+
+func (repo *Repository) ReadExercises(ctx context.Context, userUUID string, query ExerciseQuery) ([]models.Exercise, error) {
+	gormDB, logger := getDBLogger(repo, ctx, READ, userUUID)
+	tx := visibleExercises(gormDB, userUUID)
+	if query.Query != "" {
+		escaped := strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(query.Query)
+		tx = tx.Where("name ILIKE ? OR aliases::text ILIKE ?", "%"+escaped+"%", "%"+escaped+"%")
+	}
+	if query.Muscle != "" {
+		muscle, err := json.Marshal([]string{query.Muscle})
+		if err != nil {
+			return nil, err
+		}
+		tx = tx.Where("primary_muscles @> ?::jsonb OR secondary_muscles @> ?::jsonb", string(muscle), string(muscle))
+	}
+	if query.Equipment != "" {
+		tx = tx.Where("equipment = ?", query.Equipment)
+	}
+
+	exercises := []models.Exercise{}
+	if res := tx.Order("name").Find(&exercises); res.Error != nil {
+		logger.Error().Err(res.Error).Msg("failed to read exercises")
+		return nil, res.Error
+	}
+
+	return exercises, nil
+}
+
+func (repo *Repository) ReadExercise(ctx context.Context, userUUID, exerciseUUID string) (*models.Exercise, error) {
+	gormDB, logger := getDBLogger(repo, ctx, READ, userUUID)
+	var exercise *models.Exercise
+	res := visibleExercises(gormDB, userUUID).Where("uuid = ?", exerciseUUID).Find(&exercise)
+	if err := checkDBError(res); err != nil {
+		logger.Info().Err(err).Str("exercise_uuid", exerciseUUID).Msg("unable to find exercise")
+		return nil, err
+	}
+
+	return exercise, nil
+}
+
+func (repo *Repository) CreateExercise(ctx context.Context, req *ExerciseRequest) (*models.Exercise, error) {
+	gormDB, logger := getDBLogger(repo, ctx, CREATE, req.UserUUID)
+	var user *models.User
+	res := gormDB.Where("uuid = ?", req.UserUUID).Find(&user)
+	if err := checkDBError(res); err != nil {
+		logger.Error().Err(err).Msg("error finding exercise parent user")
+		return nil, err
+	}
+
+	exercise := &models.Exercise{
+		UUID:     uuid.NewString(),
+		UserID:   &user.ID,
+		UserUUID: user.UUID,
+		Custom:   true,
+	}
+	req.apply(exercise)
+	if err := checkDBError(gormDB.Create(exercise)); err != nil {
+		logger.Error().Err(err).Msg("failed to create exercise")
+		return nil, err
+	}
+
+	return exercise, nil
+}
+
+// UpdateExercise replaces a custom exercise of the user, the global catalog
+// can't be changed
+func (repo *Repository) UpdateExercise(ctx context.Context, exerciseUUID string, req *ExerciseRequest) (*models.Exercise, error) {
+	gormDB, logger := getDBLogger(repo, ctx, UPDATE, req.UserUUID)
+	logger = logger.With().Str("exercise_uuid", exerciseUUID).Logger()
+	var exercise *models.Exercise
+	dberr := gormDB.Transaction(func(tx *gorm.DB) error {
+		res := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("user_uuid = ? AND uuid = ?", req.UserUUID, exerciseUUID).
+			Find(&exercise)
+		if err := checkDBError(res); err != nil {
+			return err
+		}
+
+		req.apply(exercise)
+		return checkDBError(tx.Save(exercise))
+	})
+
+	if dberr != nil {
+		logger.Info().Err(dberr).Msg("failed to update exercise")
+		return nil, dberr
+	}
+
+	return exercise, nil
+}
+
+// CreateGlobalExercise adds an exercise to the global catalog every user sees
+func (repo *Repository) CreateGlobalExercise(ctx context.Context, req *ExerciseRequest) (*models.Exercise, error) {
+	gormDB, logger := getDBLogger(repo, ctx, CREATE, req.UserUUID)
+	exercise := &models.Exercise{UUID: uuid.NewString()}
+	req.apply(exercise)
+	if err := checkDBError(gormDB.Create(exercise)); err != nil {
+		logger.Error().Err(err).Msg("failed to create global exercise")
+		return nil, err
+	}
+
+	return exercise, nil
+}
+
+// UpdateGlobalExercise replaces a global exercise that was added with
+// CreateGlobalExercise, the ones seeded from the catalog package can't be
+// changed
+func (repo *Repository) UpdateGlobalExercise(ctx context.Context, exerciseUUID string, req *ExerciseRequest) (*models.Exercise, error) {
+	gormDB, logger := getDBLogger(repo, ctx, UPDATE, req.UserUUID)
+	logger = logger.With().Str("exercise_uuid", exerciseUUID).Logger()
+	if catalog.Seeded(exerciseUUID) {
+		return nil, fmt.Errorf("%w: %s is seeded from the catalog", ErrUnknownExercise, exerciseUUID)
+	}
+
+	var exercise *models.Exercise
+	dberr := gormDB.Transaction(func(tx *gorm.DB) error {
+		res := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("user_id IS NULL AND uuid = ?", exerciseUUID).
+			Find(&exercise)
+		if err := checkDBError(res); err != nil {
+			return err
+		}
+
+		req.apply(exercise)
+		return checkDBError(tx.Save(exercise))
+	})
+
+	if dberr != nil {
+		logger.Info().Err(dberr).Msg("failed to update global exercise")
+		return nil, dberr
+	}
+
+	return exercise, nil
+}
+
+func (repo *Repository) DeleteExercise(ctx context.Context, userUUID, exerciseUUID string) error {
+	gormDB, logger := getDBLogger(repo, ctx, DELETE, userUUID)
+	res := gormDB.Where("user_uuid = ? AND uuid = ?", userUUID, exerciseUUID).Delete(&models.Exercise{})
+	if err := checkDBError(res); err != nil {
+		logger.Info().Err(err).Str("exercise_uuid", exerciseUUID).Msg("failed to delete exercise")
+		return err
+	}
+
+	return nil
+}
+
+func (req *ExerciseRequest) apply(exercise *models.Exercise) {
+	exercise.Name = req.Name
+	exercise.PrimaryMuscles = req.PrimaryMuscles
+	exercise.SecondaryMuscles = append([]string{}, req.SecondaryMuscles...)
+	exercise.Equipment = req.Equipment
+	exercise.Movement = req.Movement
+	exercise.Unilateral = req.Unilateral
+	exercise.Aliases = append([]string{}, req.Aliases...)
+}
+
+// resolveExercises checks the catalog IDs of every lift in weeks and fills in
+// the ones that are missing by matching the exercise name. Lifts that match
+// nothing are left without an ID.
+func resolveExercises(tx *gorm.DB, userID uint, weeks *[]models.Week) error {
+	if weeks == nil {
+		return nil
+	}
+
+	// lifts may keep pointing at custom exercises that have since been
+	// deleted, new names are only matched onto live ones
+	var all, exercises []models.Exercise
+	if res := tx.Unscoped().Where("user_id IS NULL OR user_id = ?", userID).Find(&all); res.Error != nil {
+		return res.Error
+	}
+	known := make(map[string]bool, len(all))
+	for _, exercise := range all {
+		known[exercise.UUID] = true
+		if !exercise.DeletedAt.Valid {
+			exercises = append(exercises, exercise)
+		}
+	}
+
+	for i := range *weeks {
+		for _, day := range (*weeks)[i].Days() {
+			if day == nil || day.Lifts == nil {
+				continue
+			}
+			for j := range *day.Lifts {
+				lift := &(*day.Lifts)[j]
+				if lift.ExerciseID != "" {
+					if !known[lift.ExerciseID] {
+						return fmt.Errorf("%w: %s", ErrUnknownExercise, lift.ExerciseID)
+					}
+					continue
+				}
+				if exercise, _ := catalog.Match(lift.Exercise, exercises); exercise != nil {
+					lift.ExerciseID = exercise.UUID
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// seedExercises adds the global catalog, entries that already exist are
+// updated to match it
+func seedExercises(db *gorm.DB) error {
+	exercises := catalog.Exercises()
+	return db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "uuid"}},
+		DoUpdates: clause.AssignmentColumns([]string{"name", "primary_muscles", "secondary_muscles", "equipment", "movement", "unilateral", "aliases", "updated_at"}),
+	}).Create(&exercises).Error
+}
@@ -0,0 +1,295 @@
+package repository
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rekram1-node/workout-backend/models"
+	"github.com/rekram1-node/workout-backend/strength"
+)
+
+const (
+	defaultHistoryPerPage = 20
+	maxHistoryPerPage     = 100
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+type ExerciseHistoryQuery struct {
+	UserUUID   string
+	ExerciseID string
+	// From and To limit sessions to a date range, zero means unbounded
+	From, To time.Time
+	Cursor   string
+	Limit    int
+}
+
+type TopSet struct {
+	Weight float32 `json:"weight"`
+	Reps   int     `json:"reps"`
+}
+
+// ExerciseSession is a day of a meso the exercise was done on
+type ExerciseSession struct {
+	Date     time.Time    `json:"date"`
+	MesoUUID string       `json:"meso_uuid"`
+	MesoName string       `json:"meso_name"`
+	Week     int          `json:"week"`
+	Day      string       `json:"day"`
+	Sets     []models.Set `json:"sets"`
+	TopSet   TopSet       `json:"top_set"`
+	E1RM     float32      `json:"e1rm"`
+	Volume   float32      `json:"volume"`
+
+	day int
+}
+
+// SeriesPoint is a session reduced to what is charted
+type SeriesPoint struct {
+	Date   time.Time `json:"date"`
+	TopSet TopSet    `json:"top_set"`
+	E1RM   float32   `json:"e1rm"`
+	Volume float32   `json:"volume"`
+}
+
+type ExerciseHistoryResponse struct {
+	ExerciseID string `json:"exercise_id"`
+	Formula    string `json:"formula"`
+	// Sessions are a page of the sessions newest first, NextCursor reads the
+	// page after it and is empty on the last one
+	Sessions   []ExerciseSession `json:"sessions"`
+	NextCursor string            `json:"next_cursor,omitempty"`
+	// Series has every session of the date range oldest first, it is only
+	// sent with the first page
+	Series []SeriesPoint `json:"series,omitempty"`
+}
+
+// ReadExerciseHistory collects the sessions of an exercise across every meso
+// of the user, only completed sets count.
+func (repo *Repository) ReadExerciseHistory(ctx context.Context, query ExerciseHistoryQuery) (*ExerciseHistoryResponse, error) {
+	gormDB, logger := getDBLogger(repo, ctx, READ, query.UserUUID)
+	logger = logger.With().Str("exercise_uuid", query.ExerciseID).Logger()
+	if query.Limit < 1 {
+		query.Limit = defaultHistoryPerPage
+	}
+	if query.Limit > maxHistoryPerPage {
+		query.Limit = maxHistoryPerPage
+	}
+
+	var after *sessionKey
+	if query.Cursor != "" {
+		key, err := decodeCursor(query.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		after = key
+	}
+
+	var user *models.User
+	if err := checkDBError(gormDB.Where("uuid = ?", query.UserUUID).Find(&user)); err != nil {
+		logger.Info().Err(err).Msg("unable to find user")
+		return nil, err
+	}
+
+	// jsonb is printed with a space after every colon, the match is narrowed
+	// down to the lifts below
+	escaped := strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(query.ExerciseID)
+	var mesos []models.Meso
+	res := gormDB.Where("user_id = ?", user.ID).
+		Where("weeks::text LIKE ?", `%"exercise_id": "`+escaped+`"%`).
+		Find(&mesos)
+	if res.Error != nil {
+		logger.Error().Err(res.Error).Msg("failed to read mesos")
+		return nil, res.Error
+	}
+
+	sessions := []ExerciseSession{}
+	for i := range mesos {
+		found, err := exerciseSessions(&mesos[i], query.ExerciseID, user.E1RMFormula)
+		if err != nil {
+			return nil, err
+		}
+		for _, session := range found {
+			if !query.From.IsZero() && session.Date.Before(query.From) {
+				continue
+			}
+			if !query.To.IsZero() && session.Date.After(query.To) {
+				continue
+			}
+			sessions = append(sessions, session)
+		}
+	}
+
+	// newest first
+	sort.Slice(sessions, func(i, j int) bool {
+		return keyOf(&sessions[j]).less(keyOf(&sessions[i]))
+	})
+
+	response := &ExerciseHistoryResponse{
+		ExerciseID: query.ExerciseID,
+		Formula:    user.E1RMFormula,
+		Sessions:   []ExerciseSession{},
+	}
+	if after == nil {
+		response.Series = make([]SeriesPoint, 0, len(sessions))
+		for i := len(sessions) - 1; i >= 0; i-- {
+			response.Series = append(response.Series, SeriesPoint{
+				Date:   sessions[i].Date,
+				TopSet: sessions[i].TopSet,
+				E1RM:   sessions[i].E1RM,
+				Volume: sessions[i].Volume,
+			})
+		}
+	}
+
+	start := 0
+	if after != nil {
+		start = sort.Search(len(sessions), func(i int) bool {
+			return keyOf(&sessions[i]).less(*after)
+		})
+	}
+	end := start + query.Limit
+	if end > len(sessions) {
+		end = len(sessions)
+	}
+	response.Sessions = append(response.Sessions, sessions[start:end]...)
+	if end < len(sessions) {
+		response.NextCursor = encodeCursor(keyOf(&sessions[end-1]))
+	}
+
+	return response, nil
+}
+
+// exerciseSessions finds the days of the meso with completed sets of the
+// exercise. A session is dated by its last completed set, sets logged without
+// a time take the time their week was completed, or the meso was created when
+// it wasn't. Neither changes when the meso is edited, so cursors stay valid.
+func exerciseSessions(meso *models.Meso, exerciseID, formula string) ([]ExerciseSession, error) {
+	sessions := []ExerciseSession{}
+	if meso.Weeks == nil {
+		return sessions, nil
+	}
+
+	for w := range *meso.Weeks {
+		week := &(*meso.Weeks)[w]
+		undated := meso.CreatedAt
+		if week.CompletedAt != nil {
+			undated = *week.CompletedAt
+		}
+		for d, day := range week.Days() {
+			if day == nil || day.Lifts == nil {
+				continue
+			}
+
+			session := ExerciseSession{
+				MesoUUID: meso.UUID,
+				MesoName: meso.Name,
+				Week:     weekNumber(w, week),
+				Day:      models.Weekdays[d],
+				Sets:     []models.Set{},
+				day:      d,
+			}
+			for _, lift := range *day.Lifts {
+				if lift.ExerciseID != exerciseID {
+					continue
+				}
+				for _, set := range lift.Sets {
+					if !set.Completed {
+						continue
+					}
+					if err := session.add(set, formula, undated); err != nil {
+						return nil, err
+					}
+				}
+			}
+			if len(session.Sets) > 0 {
+				sessions = append(sessions, session)
+			}
+		}
+	}
+
+	return sessions, nil
+}
+
+func (s *ExerciseSession) add(set models.Set, formula string, undated time.Time) error {
+	s.Sets = append(s.Sets, set)
+
+	completedAt := undated
+	if set.CompletedAt != nil {
+		completedAt = *set.CompletedAt
+	}
+	if completedAt.After(s.Date) {
+		s.Date = completedAt
+	}
+
+	if set.Weight > s.TopSet.Weight || (set.Weight == s.TopSet.Weight && set.Reps > s.TopSet.Reps) {
+		s.TopSet = TopSet{Weight: set.Weight, Reps: set.Reps}
+	}
+
+	e1rm, err := strength.SetE1RM(formula, set)
+	if err != nil {
+		return err
+	}
+	if e1rm > s.E1RM {
+		s.E1RM = e1rm
+	}
+
+	s.Volume += set.Weight * float32(set.Reps)
+	return nil
+}
+
+// sessionKey orders sessions by date, ties are broken by where they are
+type sessionKey struct {
+	date     time.Time
+	mesoUUID string
+	week     int
+	day      int
+}
+
+func keyOf(s *ExerciseSession) sessionKey {
+	return sessionKey{date: s.Date, mesoUUID: s.MesoUUID, week: s.Week, day: s.day}
+}
+
+func (k sessionKey) less(other sessionKey) bool {
+	switch {
+	case !k.date.Equal(other.date):
+		return k.date.Before(other.date)
+	case k.mesoUUID != other.mesoUUID:
+		return k.mesoUUID < other.mesoUUID
+	case k.week != other.week:
+		return k.week < other.week
+	default:
+		return k.day < other.day
+	}
+}
+
+func encodeCursor(key sessionKey) string {
+	raw := fmt.Sprintf("%s|%s|%d|%d", key.date.UTC().Format(time.RFC3339Nano), key.mesoUUID, key.week, key.day)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeCursor(cursor string) (*sessionKey, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	parts := strings.Split(string(raw), "|")
+	if len(parts) != 4 {
+		return nil, ErrInvalidCursor
+	}
+	key := &sessionKey{mesoUUID: parts[1]}
+	if key.date, err = time.Parse(time.RFC3339Nano, parts[0]); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	if _, err := fmt.Sscanf(parts[2]+" "+parts[3], "%d %d", &key.week, &key.day); err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	return key, nil
+}
@@ -0,0 +1,84 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/rekram1-node/workout-backend/models"
+	"github.com/rekram1-node/workout-backend/throttle"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	LoginInvalidCredentials = "invalid_credentials"
+	LoginInvalidMFACode     = "invalid_mfa_code"
+	LoginThrottled          = "throttled"
+)
+
+func (repo *Repository) RecordFailedLogin(ctx context.Context, attempt *models.LoginAttempt) error {
+	gormDB, logger := getDBLogger(repo, ctx, CREATE, attempt.Username)
+	if err := checkDBError(gormDB.Create(attempt)); err != nil {
+		logger.Error().Err(err).Msg("failed to record failed login")
+		return err
+	}
+
+	return nil
+}
+
+// ThrottleStore is a throttle.Store backed by postgres, for running more
+// than one instance.
+type ThrottleStore struct {
+	repo *Repository
+}
+
+func (repo *Repository) ThrottleStore() *ThrottleStore {
+	return &ThrottleStore{repo: repo}
+}
+
+func (s *ThrottleStore) Get(ctx context.Context, key string) (throttle.State, error) {
+	var row models.LoginThrottle
+	res := s.repo.gormDB.WithContext(ctx).Where("key = ?", key).Find(&row)
+	if res.Error != nil {
+		return throttle.State{}, res.Error
+	}
+
+	return stateFromRow(row), nil
+}
+
+func (s *ThrottleStore) RecordFailure(ctx context.Context, key string, policy throttle.Policy, now time.Time) (throttle.State, error) {
+	var state throttle.State
+	dberr := s.repo.gormDB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		res := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.LoginThrottle{Key: key})
+		if res.Error != nil {
+			return res.Error
+		}
+
+		var row models.LoginThrottle
+		res = tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("key = ?", key).Find(&row)
+		if err := checkDBError(res); err != nil {
+			return err
+		}
+
+		state = policy.Fail(stateFromRow(row), now)
+		row.Failures = state.Failures
+		row.LastFailure = state.LastFailure
+		row.LockedUntil = state.LockedUntil
+
+		return tx.Save(&row).Error
+	})
+
+	return state, dberr
+}
+
+func (s *ThrottleStore) Reset(ctx context.Context, key string) error {
+	return s.repo.gormDB.WithContext(ctx).Where("key = ?", key).Delete(&models.LoginThrottle{}).Error
+}
+
+func stateFromRow(row models.LoginThrottle) throttle.State {
+	return throttle.State{
+		Failures:    row.Failures,
+		LastFailure: row.LastFailure,
+		LockedUntil: row.LockedUntil,
+	}
+}
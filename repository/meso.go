@@ -2,11 +2,26 @@ package repository
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/rekram1-node/workout-backend/models"
+	"github.com/rekram1-node/workout-backend/progression"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrMesoNotFound = errors.New("meso not found")
+	ErrWeekNotFound = errors.New("meso has no week with that number")
+	ErrDayNotFound  = errors.New("week has no lifts on that day")
+	ErrLiftNotFound = errors.New("day has no lift at that index")
+	ErrSetNotFound  = errors.New("lift has no set at that index")
+	// ErrVersionMismatch is an edit made against a version of the meso that
+	// has since changed
+	ErrVersionMismatch = errors.New("meso has changed since that version")
 )
 
 type MesoCreateRequest struct {
@@ -14,6 +29,79 @@ type MesoCreateRequest struct {
 	MesoUUID                                                       string
 	Name                                                           string      `validate:"required"`
 	Monday, Tuesday, Wednesday, Thursday, Friday, Saturday, Sunday *models.Day `validate:"required"`
+
+	// WeekCount is how many weeks are generated from the Monday to Sunday
+	// template, 0 means 1
+	WeekCount int `validate:"min=0,max=16"`
+	// DeloadWeek adds a week with half the sets after the others
+	DeloadWeek bool
+	// RIRSchedule is the RIR target of each week, e.g. [3, 2, 1, 0]. Weeks
+	// past the end of it get the last value, the deload week gets none.
+	RIRSchedule []int `validate:"max=16,dive,min=0,max=10"`
+}
+
+// generateWeeks builds the weeks of a new meso, every week gets its own copy
+// of the template lifts.
+func generateWeeks(mesoCreateReq *MesoCreateRequest) *[]models.Week {
+	template := models.Week{
+		Monday:    mesoCreateReq.Monday,
+		Tuesday:   mesoCreateReq.Tuesday,
+		Wednesday: mesoCreateReq.Wednesday,
+		Thursday:  mesoCreateReq.Thursday,
+		Friday:    mesoCreateReq.Friday,
+		Saturday:  mesoCreateReq.Saturday,
+		Sunday:    mesoCreateReq.Sunday,
+	}
+
+	count := mesoCreateReq.WeekCount
+	if count < 1 {
+		count = 1
+	}
+
+	weeks := []models.Week{}
+	for number := 1; number <= count; number++ {
+		week := copyWeek(&template, number)
+		if schedule := mesoCreateReq.RIRSchedule; len(schedule) > 0 {
+			rir := schedule[len(schedule)-1]
+			if number <= len(schedule) {
+				rir = schedule[number-1]
+			}
+			week.TargetRIR = &rir
+		}
+		weeks = append(weeks, week)
+	}
+
+	if mesoCreateReq.DeloadWeek {
+		deload := copyWeek(&template, count+1)
+		deload.Deload = true
+		for _, day := range deload.Days() {
+			if day == nil || day.Lifts == nil {
+				continue
+			}
+			for i := range *day.Lifts {
+				lift := &(*day.Lifts)[i]
+				if len(lift.Sets) > 1 {
+					lift.Sets = lift.Sets[:len(lift.Sets)/2]
+				}
+			}
+		}
+		weeks = append(weeks, deload)
+	}
+
+	return &weeks
+}
+
+func copyWeek(template *models.Week, number int) models.Week {
+	return models.Week{
+		Number:    number,
+		Monday:    template.Monday.Copy(),
+		Tuesday:   template.Tuesday.Copy(),
+		Wednesday: template.Wednesday.Copy(),
+		Thursday:  template.Thursday.Copy(),
+		Friday:    template.Friday.Copy(),
+		Saturday:  template.Saturday.Copy(),
+		Sunday:    template.Sunday.Copy(),
+	}
 }
 
 func (repo *Repository) CreateMeso(ctx context.Context, mesoCreateReq *MesoCreateRequest) (*models.Meso, error) {
@@ -32,21 +120,16 @@ func (repo *Repository) CreateMeso(ctx context.Context, mesoCreateReq *MesoCreat
 
 		mesoUUID := uuid.NewString()
 		meso = &models.Meso{
-			User:     user,
-			UserUUID: user.UUID,
-			UUID:     mesoUUID,
-			Name:     mesoCreateReq.Name,
-			Weeks: &[]models.Week{
-				{
-					Monday:    mesoCreateReq.Monday,
-					Tuesday:   mesoCreateReq.Tuesday,
-					Wednesday: mesoCreateReq.Wednesday,
-					Thursday:  mesoCreateReq.Thursday,
-					Friday:    mesoCreateReq.Friday,
-					Saturday:  mesoCreateReq.Saturday,
-					Sunday:    mesoCreateReq.Sunday,
-				},
-			},
+			User:        user,
+			UserUUID:    user.UUID,
+			UUID:        mesoUUID,
+			Name:        mesoCreateReq.Name,
+			Weeks:       generateWeeks(mesoCreateReq),
+			RIRSchedule: mesoCreateReq.RIRSchedule,
+			Version:     1,
+		}
+		if err := resolveExercises(tx, user.ID, meso.Weeks); err != nil {
+			return err
 		}
 
 		for _, obj := range []interface{}{meso} {
@@ -56,7 +139,7 @@ func (repo *Repository) CreateMeso(ctx context.Context, mesoCreateReq *MesoCreat
 			}
 		}
 
-		return nil
+		return recordRevision(ctx, tx, meso, nil)
 	})
 
 	if dberr != nil {
@@ -70,9 +153,21 @@ func (repo *Repository) CreateMeso(ctx context.Context, mesoCreateReq *MesoCreat
 }
 
 type MesoResponse struct {
-	Name  string
-	UUID  string
-	Weeks *[]models.Week
+	Name        string
+	UUID        string
+	Weeks       *[]models.Week
+	RIRSchedule []int `json:",omitempty"`
+	Version     int
+}
+
+func mesoResponse(meso *models.Meso) *MesoResponse {
+	return &MesoResponse{
+		Name:        meso.Name,
+		UUID:        meso.UUID,
+		Weeks:       meso.Weeks,
+		RIRSchedule: meso.RIRSchedule,
+		Version:     meso.Version,
+	}
 }
 
 func (repo *Repository) ReadMeso(ctx context.Context, userUUID, mesoUUID string) (*MesoResponse, error) {
@@ -87,13 +182,7 @@ func (repo *Repository) ReadMeso(ctx context.Context, userUUID, mesoUUID string)
 		return nil, err
 	}
 
-	mesoResponse := MesoResponse{
-		Name:  meso.Name,
-		UUID:  meso.UUID,
-		Weeks: meso.Weeks,
-	}
-
-	return &mesoResponse, nil
+	return mesoResponse(meso), nil
 }
 
 func (repo *Repository) ReadxMesos(ctx context.Context, userUUID string, mesoCount int) (*[]MesoResponse, error) {
@@ -109,13 +198,8 @@ func (repo *Repository) ReadxMesos(ctx context.Context, userUUID string, mesoCou
 		return nil, err
 	}
 
-	for _, meso := range mesos {
-		mesoRes := MesoResponse{
-			Name:  meso.Name,
-			UUID:  meso.UUID,
-			Weeks: meso.Weeks,
-		}
-		foundMesos = append(foundMesos, mesoRes)
+	for i := range mesos {
+		foundMesos = append(foundMesos, *mesoResponse(&mesos[i]))
 	}
 
 	return &foundMesos, nil
@@ -124,57 +208,85 @@ func (repo *Repository) ReadxMesos(ctx context.Context, userUUID string, mesoCou
 type MesoUpdateRequest struct {
 	UserUUID string
 	MesoUUID string
-	Name     string
-	Weeks    *[]models.Week
+	// Version is the version of the meso the update was made against, 0
+	// updates any version
+	Version int
+	Name    string
+	Weeks   *[]models.Week
 }
 
 func (repo *Repository) UpdateMeso(ctx context.Context, mesoUpdateReq *MesoUpdateRequest) (*MesoResponse, error) {
-	gormDB, logger := getDBLogger(repo, ctx, UPDATE, mesoUpdateReq.UserUUID)
-	logger = logger.With().Str("meso_uuid", mesoUpdateReq.MesoUUID).Logger()
-	var meso models.Meso
-	res := gormDB.Where("user_uuid = ?", mesoUpdateReq.UserUUID).Where("uuid = ?", mesoUpdateReq.MesoUUID).First(&meso)
-	if res.Error != nil || res.RowsAffected == 0 {
-		return nil, fmt.Errorf("no meso found with uuid [%s] for user [%s]: %w", mesoUpdateReq.MesoUUID, mesoUpdateReq.UserUUID, res.Error)
-	}
-
-	dberr := repo.gormDB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
-		updates := make(map[string]interface{})
+	return repo.EditMeso(ctx, mesoUpdateReq.UserUUID, mesoUpdateReq.MesoUUID, mesoUpdateReq.Version, func(meso *models.Meso) error {
 		if mesoUpdateReq.Name != "" {
-			updates["name"] = mesoUpdateReq.Name
+			meso.Name = mesoUpdateReq.Name
 		}
 		if mesoUpdateReq.Weeks != nil {
-			updates["week"] = mesoUpdateReq.Weeks
+			meso.Weeks = mesoUpdateReq.Weeks
 		}
+		return nil
+	})
+}
 
-		res := tx.WithContext(ctx).Model(&meso).
-			Where("user_uuid = ?", mesoUpdateReq.UserUUID).
-			Where("uuid = ?", mesoUpdateReq.MesoUUID).
-			Updates(updates).Find(&meso)
+// editMeso applies edit to the meso of the user with the row locked and saves
+// it as the next version. Every change to a meso goes through here so that
+// lifts always get their catalog IDs resolved. A version other than 0 fails
+// with ErrVersionMismatch when the meso is at another one.
+func (repo *Repository) editMeso(ctx context.Context, userUUID, mesoUUID string, version int, edit func(tx *gorm.DB, meso *models.Meso) error) (*models.Meso, error) {
+	gormDB, logger := getDBLogger(repo, ctx, UPDATE, userUUID)
+	logger = logger.With().Str("meso_uuid", mesoUUID).Logger()
+	var meso models.Meso
+	dberr := gormDB.Transaction(func(tx *gorm.DB) error {
+		res := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("user_uuid = ? AND uuid = ?", userUUID, mesoUUID).
+			Find(&meso)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return fmt.Errorf("%w: no meso with uuid [%s] for user [%s]", ErrMesoNotFound, mesoUUID, userUUID)
+		}
+		if version != 0 && meso.Version != version {
+			return fmt.Errorf("%w: meso is at version %d", ErrVersionMismatch, meso.Version)
+		}
+		before, err := contentOf(&meso)
+		if err != nil {
+			return err
+		}
 
-		if err := checkDBError(res); err != nil {
-			logger.Error().Err(err).Msg("error updating meso metadata")
+		if err := edit(tx, &meso); err != nil {
+			return err
+		}
+		if err := resolveExercises(tx, meso.UserID, meso.Weeks); err != nil {
 			return err
 		}
 
-		return nil
+		meso.Version++
+		if err := checkDBError(tx.Model(&meso).Select("name", "weeks", "rir_schedule", "version", "updated_at").Updates(&meso)); err != nil {
+			return err
+		}
+		return recordRevision(ctx, tx, &meso, before)
 	})
 
 	if dberr != nil {
-		logger.Error().Err(dberr).Msg("error updating meso")
+		logger.Info().Err(dberr).Msg("failed to update meso")
 		return nil, dberr
 	}
 
-	return repo.ReadMeso(ctx, mesoUpdateReq.UserUUID, mesoUpdateReq.MesoUUID)
+	return &meso, nil
 }
 
-func (repo *Repository) DeleteMeso(ctx context.Context, userUUID, mesoUUID string) error {
+// DeleteMeso deletes the meso, a version other than 0 fails with
+// ErrVersionMismatch when the meso is at another one
+func (repo *Repository) DeleteMeso(ctx context.Context, userUUID, mesoUUID string, version int) error {
 	db, logger := getDBLogger(repo, ctx, DELETE, mesoUUID)
 	logger = logger.With().Str("user", userUUID).Logger()
 	dberr := db.Transaction(func(tx *gorm.DB) error {
 		tx = tx.WithContext(ctx)
 		var meso models.Meso
 
-		dbMeso := tx.
+		// the row stays locked until the delete so no change lands between
+		// checking the version and deleting it
+		dbMeso := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
 			Where("user_uuid", userUUID).
 			Where("uuid", mesoUUID).
 			First(&meso)
@@ -182,6 +294,9 @@ func (repo *Repository) DeleteMeso(ctx context.Context, userUUID, mesoUUID strin
 			logger.Error().Err(err).Msg("unable to lookup meso")
 			return err
 		}
+		if version != 0 && meso.Version != version {
+			return fmt.Errorf("%w: meso is at version %d", ErrVersionMismatch, meso.Version)
+		}
 
 		resultDelete := tx.
 			Where("uuid = ?", mesoUUID).
@@ -200,3 +315,91 @@ func (repo *Repository) DeleteMeso(ctx context.Context, userUUID, mesoUUID strin
 
 	return nil
 }
+
+// CompleteWeek marks a week of the meso as completed and sets the targets of
+// the week after it from what was logged. A version other than 0 fails with
+// ErrVersionMismatch when the meso is at another one.
+func (repo *Repository) CompleteWeek(ctx context.Context, userUUID, mesoUUID string, version, number int) (*MesoResponse, error) {
+	_, logger := getDBLogger(repo, ctx, UPDATE, userUUID)
+	_, err := repo.editMeso(ctx, userUUID, mesoUUID, version, func(tx *gorm.DB, meso *models.Meso) error {
+		if meso.Weeks == nil {
+			return ErrWeekNotFound
+		}
+
+		weeks := *meso.Weeks
+		current := -1
+		for i := range weeks {
+			if weekNumber(i, &weeks[i]) == number {
+				current = i
+				break
+			}
+		}
+		if current < 0 {
+			return ErrWeekNotFound
+		}
+
+		now := time.Now()
+		weeks[current].CompletedAt = &now
+		if current+1 < len(weeks) {
+			return progression.NextWeek(&weeks[current], &weeks[current+1])
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Info().Str("meso_uuid", mesoUUID).Int("week", number).Msg("completed week")
+	return repo.ReadMeso(ctx, userUUID, mesoUUID)
+}
+
+// weekNumber is the number of the week at index i, weeks of mesos created
+// before weeks were numbered go by their position
+func weekNumber(i int, week *models.Week) int {
+	if week.Number > 0 {
+		return week.Number
+	}
+
+	return i + 1
+}
+
+// findWeek returns the week of the meso with number
+func findWeek(meso *models.Meso, number int) (*models.Week, error) {
+	if meso.Weeks == nil {
+		return nil, ErrWeekNotFound
+	}
+	for i := range *meso.Weeks {
+		if week := &(*meso.Weeks)[i]; weekNumber(i, week) == number {
+			return week, nil
+		}
+	}
+
+	return nil, ErrWeekNotFound
+}
+
+// findLift returns the lift at index on the day of week number, along with
+// the day it is on
+func findLift(meso *models.Meso, number int, weekday string, index int) (*models.Day, *models.Lift, error) {
+	week, err := findWeek(meso, number)
+	if err != nil {
+		return nil, nil, err
+	}
+	day := week.Day(weekday)
+	if day == nil || day.Lifts == nil {
+		return nil, nil, ErrDayNotFound
+	}
+	if index < 0 || index >= len(*day.Lifts) {
+		return nil, nil, ErrLiftNotFound
+	}
+
+	return day, &(*day.Lifts)[index], nil
+}
+
+func (repo *Repository) ReadWeek(ctx context.Context, userUUID, mesoUUID string, number int) (*models.Week, error) {
+	meso, err := repo.ReadMeso(ctx, userUUID, mesoUUID)
+	if err != nil {
+		return nil, err
+	}
+
+	return findWeek(&models.Meso{Weeks: meso.Weeks}, number)
+}
@@ -0,0 +1,364 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/rekram1-node/workout-backend/jsonpatch"
+	"github.com/rekram1-node/workout-backend/models"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrInvalidPatch = errors.New("invalid patch")
+	ErrInvalidOrder    = errors.New("order must list every lift index once")
+	ErrInvalidPosition = errors.New("insert position is past the end")
+)
+
+// MesoEdit changes part of a meso in place, see EditMeso
+type MesoEdit func(meso *models.Meso) error
+
+// EditMeso applies edit to the meso atomically, nothing is saved when it
+// fails. A version other than 0 fails with ErrVersionMismatch when the meso
+// is at another one.
+func (repo *Repository) EditMeso(ctx context.Context, userUUID, mesoUUID string, version int, edit MesoEdit) (*MesoResponse, error) {
+	meso, err := repo.editMeso(ctx, userUUID, mesoUUID, version, func(tx *gorm.DB, meso *models.Meso) error {
+		return edit(meso)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return mesoResponse(meso), nil
+}
+
+// mesoPatch is what a patched MesoResponse has to be to be saved
+type mesoPatch struct {
+	Name        string         `validate:"required"`
+	UUID        string         `validate:"required"`
+	Weeks       *[]models.Week `validate:"required,dive"`
+	RIRSchedule []int          `json:",omitempty" validate:"max=16,dive,min=0,max=10"`
+	Version     int
+}
+
+// PatchMeso applies patch to the JSON of the MesoResponse of the meso with
+// apply, jsonpatch.MergePatch or jsonpatch.Apply, and saves the result when
+// it is still a valid meso.
+func (repo *Repository) PatchMeso(ctx context.Context, userUUID, mesoUUID string, version int, apply func(doc, patch []byte) ([]byte, error), patch []byte) (*MesoResponse, error) {
+	return repo.EditMeso(ctx, userUUID, mesoUUID, version, func(meso *models.Meso) error {
+		current, err := json.Marshal(mesoResponse(meso))
+		if err != nil {
+			return err
+		}
+		patched, err := apply(current, patch)
+		if err != nil {
+			return err
+		}
+
+		var res mesoPatch
+		decoder := json.NewDecoder(bytes.NewReader(patched))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&res); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidPatch, err)
+		}
+		if err := validator.New().Struct(res); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidPatch, err)
+		}
+		if res.UUID != meso.UUID || res.Version != meso.Version {
+			return fmt.Errorf("%w: UUID and Version can't be changed", ErrInvalidPatch)
+		}
+
+		meso.Name = res.Name
+		meso.Weeks = res.Weeks
+		meso.RIRSchedule = res.RIRSchedule
+		return nil
+	})
+}
+
+func (repo *Repository) ReadDay(ctx context.Context, userUUID, mesoUUID string, number int, weekday string) (*models.Day, error) {
+	week, err := repo.ReadWeek(ctx, userUUID, mesoUUID, number)
+	if err != nil {
+		return nil, err
+	}
+	day := week.Day(weekday)
+	if day == nil {
+		return nil, ErrDayNotFound
+	}
+
+	return day, nil
+}
+
+func (repo *Repository) ReadLift(ctx context.Context, userUUID, mesoUUID string, number int, weekday string, index int) (*models.Lift, error) {
+	day, err := repo.ReadDay(ctx, userUUID, mesoUUID, number, weekday)
+	if err != nil {
+		return nil, err
+	}
+	if day.Lifts == nil || index < 0 || index >= len(*day.Lifts) {
+		return nil, ErrLiftNotFound
+	}
+
+	return &(*day.Lifts)[index], nil
+}
+
+// renumberWeeks numbers the weeks by their position after one was added or
+// removed
+func renumberWeeks(meso *models.Meso) {
+	for i := range *meso.Weeks {
+		(*meso.Weeks)[i].Number = i + 1
+	}
+}
+
+// insertPosition is where an insert at index goes in a list of length n, -1
+// is the end
+func insertPosition(index, n int) (int, error) {
+	if index == -1 {
+		return n, nil
+	}
+	if index < 0 || index > n {
+		return 0, ErrInvalidPosition
+	}
+	return index, nil
+}
+
+func ReplaceWeek(number int, week models.Week) MesoEdit {
+	return func(meso *models.Meso) error {
+		current, err := findWeek(meso, number)
+		if err != nil {
+			return err
+		}
+		week.Number = current.Number
+		*current = week
+		return nil
+	}
+}
+
+func PatchWeek(number int, patch []byte) MesoEdit {
+	return func(meso *models.Meso) error {
+		current, err := findWeek(meso, number)
+		if err != nil {
+			return err
+		}
+		var week models.Week
+		if err := patchJSON(current, patch, &week); err != nil {
+			return err
+		}
+		week.Number = current.Number
+		*current = week
+		return nil
+	}
+}
+
+// InsertWeek adds week at index, the weeks from index on move back by one. An
+// index of -1 appends it, one past the end is ErrInvalidPosition.
+func InsertWeek(index int, week models.Week) MesoEdit {
+	return func(meso *models.Meso) error {
+		if meso.Weeks == nil {
+			meso.Weeks = &[]models.Week{}
+		}
+		weeks := *meso.Weeks
+		at, err := insertPosition(index, len(weeks))
+		if err != nil {
+			return err
+		}
+
+		weeks = append(weeks, models.Week{})
+		copy(weeks[at+1:], weeks[at:])
+		weeks[at] = week
+		meso.Weeks = &weeks
+		renumberWeeks(meso)
+		return nil
+	}
+}
+
+// DeleteWeek removes a week, the weeks after it move up by one
+func DeleteWeek(number int) MesoEdit {
+	return func(meso *models.Meso) error {
+		if meso.Weeks == nil {
+			return ErrWeekNotFound
+		}
+		weeks := *meso.Weeks
+		for i := range weeks {
+			if weekNumber(i, &weeks[i]) == number {
+				weeks = append(weeks[:i], weeks[i+1:]...)
+				meso.Weeks = &weeks
+				renumberWeeks(meso)
+				return nil
+			}
+		}
+
+		return ErrWeekNotFound
+	}
+}
+
+func ReplaceDay(number int, weekday string, day models.Day) MesoEdit {
+	return func(meso *models.Meso) error {
+		week, err := findWeek(meso, number)
+		if err != nil {
+			return err
+		}
+		if !week.SetDay(weekday, &day) {
+			return ErrDayNotFound
+		}
+		return nil
+	}
+}
+
+func PatchDay(number int, weekday string, patch []byte) MesoEdit {
+	return func(meso *models.Meso) error {
+		week, err := findWeek(meso, number)
+		if err != nil {
+			return err
+		}
+		current := week.Day(weekday)
+		if current == nil {
+			return ErrDayNotFound
+		}
+		var day models.Day
+		if err := patchJSON(current, patch, &day); err != nil {
+			return err
+		}
+		week.SetDay(weekday, &day)
+		return nil
+	}
+}
+
+// ClearDay makes the day a rest day by removing its lifts
+func ClearDay(number int, weekday string) MesoEdit {
+	return func(meso *models.Meso) error {
+		week, err := findWeek(meso, number)
+		if err != nil {
+			return err
+		}
+		if !week.SetDay(weekday, &models.Day{Lifts: &[]models.Lift{}}) {
+			return ErrDayNotFound
+		}
+		return nil
+	}
+}
+
+func ReplaceLift(number int, weekday string, index int, lift models.Lift) MesoEdit {
+	return func(meso *models.Meso) error {
+		_, current, err := findLift(meso, number, weekday, index)
+		if err != nil {
+			return err
+		}
+		*current = lift
+		return nil
+	}
+}
+
+func PatchLift(number int, weekday string, index int, patch []byte) MesoEdit {
+	return func(meso *models.Meso) error {
+		_, current, err := findLift(meso, number, weekday, index)
+		if err != nil {
+			return err
+		}
+		var lift models.Lift
+		if err := patchJSON(current, patch, &lift); err != nil {
+			return err
+		}
+		*current = lift
+		return nil
+	}
+}
+
+// InsertLift adds lift at index, the lifts from index on move back by one. An
+// index of -1 appends it, a rest day becomes a training day.
+func InsertLift(number int, weekday string, index int, lift models.Lift) MesoEdit {
+	return func(meso *models.Meso) error {
+		week, err := findWeek(meso, number)
+		if err != nil {
+			return err
+		}
+		day := week.Day(weekday)
+		if day == nil {
+			day = &models.Day{}
+			if !week.SetDay(weekday, day) {
+				return ErrDayNotFound
+			}
+		}
+		if day.Lifts == nil {
+			day.Lifts = &[]models.Lift{}
+		}
+
+		lifts := *day.Lifts
+		at, err := insertPosition(index, len(lifts))
+		if err != nil {
+			return err
+		}
+		lifts = append(lifts, models.Lift{})
+		copy(lifts[at+1:], lifts[at:])
+		lifts[at] = lift
+		day.Lifts = &lifts
+		return nil
+	}
+}
+
+func DeleteLift(number int, weekday string, index int) MesoEdit {
+	return func(meso *models.Meso) error {
+		day, _, err := findLift(meso, number, weekday, index)
+		if err != nil {
+			return err
+		}
+		lifts := append((*day.Lifts)[:index], (*day.Lifts)[index+1:]...)
+		day.Lifts = &lifts
+		return nil
+	}
+}
+
+// ReorderLifts puts the lifts of a day in order, order[i] is the current
+// index of the lift that moves to i
+func ReorderLifts(number int, weekday string, order []int) MesoEdit {
+	return func(meso *models.Meso) error {
+		week, err := findWeek(meso, number)
+		if err != nil {
+			return err
+		}
+		day := week.Day(weekday)
+		if day == nil || day.Lifts == nil {
+			return ErrDayNotFound
+		}
+
+		lifts := *day.Lifts
+		if len(order) != len(lifts) {
+			return ErrInvalidOrder
+		}
+		seen := make([]bool, len(lifts))
+		reordered := make([]models.Lift, len(lifts))
+		for i, from := range order {
+			if from < 0 || from >= len(lifts) || seen[from] {
+				return ErrInvalidOrder
+			}
+			seen[from] = true
+			reordered[i] = lifts[from]
+		}
+		day.Lifts = &reordered
+		return nil
+	}
+}
+
+// patchJSON applies patch, a JSON Merge Patch, to current and decodes the
+// result into v, which must be a zero value so members the patch removes stay
+// removed, then checks that v is still valid
+func patchJSON(current interface{}, patch []byte, v interface{}) error {
+	doc, err := json.Marshal(current)
+	if err != nil {
+		return err
+	}
+	merged, err := jsonpatch.MergePatch(doc, patch)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(merged, v); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidPatch, err)
+	}
+	if err := validator.New().Struct(v); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidPatch, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,211 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/rekram1-node/workout-backend/auth"
+	"github.com/rekram1-node/workout-backend/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrMFAAlreadyEnabled = errors.New("two factor authentication is already enabled")
+	ErrMFANotEnrolled    = errors.New("two factor authentication has not been set up")
+	ErrInvalidMFACode    = errors.New("invalid two factor code")
+)
+
+// StartTOTPEnrollment stores a new pending secret, replacing any previous
+// enrollment that was never confirmed.
+func (repo *Repository) StartTOTPEnrollment(ctx context.Context, userUUID, secret string) (*models.User, error) {
+	gormDB, logger := getDBLogger(repo, ctx, UPDATE, userUUID)
+	var user *models.User
+	dberr := gormDB.Transaction(func(tx *gorm.DB) error {
+		res := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("uuid = ?", userUUID).Find(&user)
+		if err := checkDBError(res); err != nil {
+			return err
+		}
+		if user.MFAEnabled {
+			return ErrMFAAlreadyEnabled
+		}
+
+		return checkDBError(tx.Model(user).Updates(map[string]interface{}{
+			"totp_secret":    secret,
+			"totp_last_step": 0,
+		}))
+	})
+
+	if dberr != nil {
+		if !errors.Is(dberr, ErrMFAAlreadyEnabled) {
+			logger.Error().Err(dberr).Msg("failed to start totp enrollment")
+		}
+		return nil, dberr
+	}
+
+	return user, nil
+}
+
+// ConfirmTOTP enables two factor authentication once the user proves their
+// authenticator works, and stores their recovery codes.
+func (repo *Repository) ConfirmTOTP(ctx context.Context, userUUID, code string, recoveryCodeHashes []string) error {
+	gormDB, logger := getDBLogger(repo, ctx, UPDATE, userUUID)
+	dberr := gormDB.Transaction(func(tx *gorm.DB) error {
+		var user *models.User
+		res := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("uuid = ?", userUUID).Find(&user)
+		if err := checkDBError(res); err != nil {
+			return err
+		}
+
+		switch {
+		case user.MFAEnabled:
+			return ErrMFAAlreadyEnabled
+		case user.TOTPSecret == "":
+			return ErrMFANotEnrolled
+		}
+
+		step, ok := auth.ValidateTOTP(user.TOTPSecret, code, time.Now(), user.TOTPLastStep)
+		if !ok {
+			return ErrInvalidMFACode
+		}
+
+		res = tx.Model(user).Updates(map[string]interface{}{
+			"mfa_enabled":    true,
+			"totp_last_step": step,
+		})
+		if err := checkDBError(res); err != nil {
+			return err
+		}
+
+		return replaceRecoveryCodes(tx, user.ID, recoveryCodeHashes)
+	})
+
+	if dberr != nil {
+		logger.Info().Err(dberr).Msg("failed to confirm totp enrollment")
+		return dberr
+	}
+
+	return nil
+}
+
+// VerifyMFA checks a TOTP code or an unused recovery code for the user and
+// uses it up.
+func (repo *Repository) VerifyMFA(ctx context.Context, userUUID, code string) (*models.User, error) {
+	gormDB, logger := getDBLogger(repo, ctx, READ, userUUID)
+	var user *models.User
+	dberr := gormDB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		user, err = verifyMFA(tx, userUUID, code)
+		return err
+	})
+
+	if dberr != nil {
+		logger.Info().Err(dberr).Msg("two factor verification failed")
+		return nil, dberr
+	}
+
+	return user, nil
+}
+
+// DisableTOTP turns two factor authentication off, it needs both the password
+// and a current code (or recovery code).
+func (repo *Repository) DisableTOTP(ctx context.Context, userUUID, password, code string) error {
+	gormDB, logger := getDBLogger(repo, ctx, UPDATE, userUUID)
+	dberr := gormDB.Transaction(func(tx *gorm.DB) error {
+		user, err := verifyMFA(tx, userUUID, code)
+		if err != nil {
+			return err
+		}
+
+		ok, err := repo.passwords.Verify(password, user.Password)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return ErrInvalidPassword
+		}
+
+		res := tx.Model(user).Updates(map[string]interface{}{
+			"mfa_enabled":    false,
+			"totp_secret":    "",
+			"totp_last_step": 0,
+		})
+		if err := checkDBError(res); err != nil {
+			return err
+		}
+
+		return tx.Where("user_id = ?", user.ID).Delete(&models.RecoveryCode{}).Error
+	})
+
+	if dberr != nil {
+		logger.Info().Err(dberr).Msg("failed to disable totp")
+		return dberr
+	}
+
+	return nil
+}
+
+// RegenerateRecoveryCodes replaces every recovery code of the user, it needs a
+// current code.
+func (repo *Repository) RegenerateRecoveryCodes(ctx context.Context, userUUID, code string, recoveryCodeHashes []string) error {
+	gormDB, logger := getDBLogger(repo, ctx, UPDATE, userUUID)
+	dberr := gormDB.Transaction(func(tx *gorm.DB) error {
+		user, err := verifyMFA(tx, userUUID, code)
+		if err != nil {
+			return err
+		}
+
+		return replaceRecoveryCodes(tx, user.ID, recoveryCodeHashes)
+	})
+
+	if dberr != nil {
+		logger.Info().Err(dberr).Msg("failed to regenerate recovery codes")
+		return dberr
+	}
+
+	return nil
+}
+
+func verifyMFA(tx *gorm.DB, userUUID, code string) (*models.User, error) {
+	var user *models.User
+	res := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("uuid = ?", userUUID).Find(&user)
+	if err := checkDBError(res); err != nil {
+		return nil, err
+	}
+	if !user.MFAEnabled {
+		return nil, ErrMFANotEnrolled
+	}
+
+	if step, ok := auth.ValidateTOTP(user.TOTPSecret, code, time.Now(), user.TOTPLastStep); ok {
+		if err := checkDBError(tx.Model(user).Update("totp_last_step", step)); err != nil {
+			return nil, err
+		}
+		return user, nil
+	}
+
+	res = tx.Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", user.ID, auth.HashRecoveryCode(code)).
+		Update("used_at", time.Now())
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return nil, ErrInvalidMFACode
+	}
+
+	return user, nil
+}
+
+func replaceRecoveryCodes(tx *gorm.DB, userID uint, hashes []string) error {
+	if err := tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+		return err
+	}
+
+	codes := make([]models.RecoveryCode, 0, len(hashes))
+	for _, hash := range hashes {
+		codes = append(codes, models.RecoveryCode{UserID: userID, CodeHash: hash})
+	}
+
+	return checkDBError(tx.Create(&codes))
+}
@@ -0,0 +1,71 @@
+package repository
+
+import (
+	"fmt"
+
+	"github.com/rekram1-node/workout-backend/models"
+	"gorm.io/gorm"
+)
+
+// migrateLegacySets rewrites mesos whose lifts still store sets as a count.
+// Reading them expands the count into set rows (see models.Lift), so saving
+// them again is all it takes. Deleted mesos are migrated too so they can be
+// restored, hooks are skipped so updated_at is left alone.
+func migrateLegacySets(db *gorm.DB) error {
+	var mesos []models.Meso
+	db = db.Session(&gorm.Session{SkipHooks: true}).Unscoped()
+	res := db.
+		Where(`weeks::text ~ '"sets": -?[0-9]'`).
+		FindInBatches(&mesos, 100, func(tx *gorm.DB, batch int) error {
+			for i := range mesos {
+				res := db.Model(&mesos[i]).Select("weeks").Updates(&mesos[i])
+				if res.Error != nil {
+					return fmt.Errorf("failed to migrate sets of meso %s: %w", mesos[i].UUID, res.Error)
+				}
+			}
+			return nil
+		})
+
+	return res.Error
+}
+
+// runOnce applies the named data migration unless it has been applied before
+func runOnce(db *gorm.DB, name string, migrate func(db *gorm.DB) error) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if res := tx.Model(&models.Migration{}).Where("name = ?", name).Count(&count); res.Error != nil {
+			return res.Error
+		}
+		if count > 0 {
+			return nil
+		}
+
+		if err := migrate(tx); err != nil {
+			return fmt.Errorf("failed to apply migration %s: %w", name, err)
+		}
+
+		return tx.Create(&models.Migration{Name: name}).Error
+	})
+}
+
+// migrateExerciseIDs gives the lifts of existing mesos the catalog ID their
+// free text name matches, see catalog.Match
+func migrateExerciseIDs(db *gorm.DB) error {
+	var mesos []models.Meso
+	db = db.Session(&gorm.Session{SkipHooks: true}).Unscoped()
+	res := db.Where("weeks IS NOT NULL").
+		FindInBatches(&mesos, 100, func(tx *gorm.DB, batch int) error {
+			for i := range mesos {
+				if err := resolveExercises(db, mesos[i].UserID, mesos[i].Weeks); err != nil {
+					return fmt.Errorf("failed to match exercises of meso %s: %w", mesos[i].UUID, err)
+				}
+				res := db.Model(&mesos[i]).Select("weeks").Updates(&mesos[i])
+				if res.Error != nil {
+					return fmt.Errorf("failed to migrate exercises of meso %s: %w", mesos[i].UUID, res.Error)
+				}
+			}
+			return nil
+		})
+
+	return res.Error
+}
@@ -0,0 +1,23 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/rekram1-node/workout-backend/models"
+)
+
+func (repo *Repository) EnqueueOutboxMessage(ctx context.Context, recipient, subject, body string) error {
+	gormDB, logger := getDBLogger(repo, ctx, CREATE, recipient)
+	msg := &models.OutboxMessage{
+		Recipient: recipient,
+		Subject:   subject,
+		Body:      body,
+	}
+
+	if err := checkDBError(gormDB.Create(msg)); err != nil {
+		logger.Error().Err(err).Msg("failed to enqueue outbox message")
+		return err
+	}
+
+	return nil
+}
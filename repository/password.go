@@ -0,0 +1,130 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/rekram1-node/workout-backend/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrInvalidPassword      = errors.New("current password is incorrect")
+	ErrPasswordResetInvalid = errors.New("invalid or expired password reset token")
+)
+
+type PasswordChangeRequest struct {
+	CurrentPassword string `json:"current_password" validate:"required"`
+	NewPassword     string `json:"new_password" validate:"required,min=8,max=256"`
+}
+
+func (repo *Repository) ChangePassword(ctx context.Context, userUUID string, passwordReq PasswordChangeRequest) error {
+	gormDB, logger := getDBLogger(repo, ctx, UPDATE, userUUID)
+	var user *models.User
+	res := gormDB.Where("uuid = ?", userUUID).Find(&user)
+	if err := checkDBError(res); err != nil {
+		logger.Error().Err(err).Msg("unable to find user")
+		return err
+	}
+
+	ok, err := repo.passwords.Verify(passwordReq.CurrentPassword, user.Password)
+	if err != nil {
+		logger.Error().Err(err).Msg("unable to verify password")
+		return err
+	}
+	if !ok {
+		return ErrInvalidPassword
+	}
+
+	return repo.setPassword(gormDB, user.ID, passwordReq.NewPassword)
+}
+
+func (repo *Repository) setPassword(tx *gorm.DB, userID uint, password string) error {
+	hash, err := repo.passwords.Hash(password)
+	if err != nil {
+		return fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	res := tx.Model(&models.User{}).
+		Where("id = ?", userID).
+		Updates(map[string]interface{}{
+			"password":                hash,
+			"password_reset_required": false,
+		})
+
+	return checkDBError(res)
+}
+
+// CreatePasswordReset stores a reset token for the user with username and
+// returns the user so they can be notified.
+func (repo *Repository) CreatePasswordReset(ctx context.Context, username, tokenHash string, expiresAt time.Time) (*models.User, error) {
+	gormDB := repo.gormDB.WithContext(ctx)
+	var user *models.User
+	res := gormDB.Where("username = ?", username).Find(&user)
+	if err := checkDBError(res); err != nil {
+		return nil, err
+	}
+
+	_, logger := getDBLogger(repo, ctx, CREATE, user.UUID)
+	resetToken := &models.PasswordResetToken{
+		UserID:    user.ID,
+		UserUUID:  user.UUID,
+		TokenHash: tokenHash,
+		ExpiresAt: expiresAt,
+	}
+	if err := checkDBError(gormDB.Create(resetToken)); err != nil {
+		logger.Error().Err(err).Msg("failed to create password reset token")
+		return nil, err
+	}
+
+	return user, nil
+}
+
+type PasswordResetRequest struct {
+	Token       string `json:"token" validate:"required"`
+	NewPassword string `json:"new_password" validate:"required,min=8,max=256"`
+}
+
+// ResetPassword consumes a reset token and sets the new password. Every other
+// outstanding reset token of the user is used up along with it. It returns
+// the UUID of the user whose password was reset.
+func (repo *Repository) ResetPassword(ctx context.Context, tokenHash, newPassword string) (string, error) {
+	gormDB := repo.gormDB.WithContext(ctx)
+	var resetToken models.PasswordResetToken
+
+	dberr := gormDB.Transaction(func(tx *gorm.DB) error {
+		res := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("token_hash = ?", tokenHash).
+			Find(&resetToken)
+		if res.Error != nil {
+			return res.Error
+		}
+
+		now := time.Now()
+		if res.RowsAffected == 0 || resetToken.UsedAt != nil || now.After(resetToken.ExpiresAt) {
+			return ErrPasswordResetInvalid
+		}
+
+		res = tx.Model(&models.PasswordResetToken{}).
+			Where("user_id = ? AND used_at IS NULL", resetToken.UserID).
+			Update("used_at", now)
+		if err := checkDBError(res); err != nil {
+			return err
+		}
+
+		return repo.setPassword(tx, resetToken.UserID, newPassword)
+	})
+
+	if dberr != nil {
+		if !errors.Is(dberr, ErrPasswordResetInvalid) {
+			_, logger := getDBLogger(repo, ctx, UPDATE, resetToken.UserUUID)
+			logger.Error().Err(dberr).Msg("failed to reset password")
+		}
+		return "", dberr
+	}
+
+	return resetToken.UserUUID, nil
+}
@@ -0,0 +1,153 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rekram1-node/workout-backend/auth"
+	"github.com/rekram1-node/workout-backend/models"
+	"github.com/rs/zerolog"
+)
+
+// last used is only written when it is older than this, so a busy script
+// does not turn every request into a write
+const personalAccessTokenTouchInterval = time.Minute
+
+type PersonalAccessTokenCreateRequest struct {
+	Name      string     `json:"name" validate:"required,max=64"`
+	Scopes    []string   `json:"scopes" validate:"required,min=1,dive,oneof=meso:read meso:write user:read user:write"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+type PersonalAccessTokenResponse struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	Token      string     `json:"token,omitempty"`
+}
+
+func newPersonalAccessTokenResponse(pat *models.PersonalAccessToken) PersonalAccessTokenResponse {
+	return PersonalAccessTokenResponse{
+		ID:         pat.UUID,
+		Name:       pat.Name,
+		Prefix:     pat.Prefix,
+		Scopes:     pat.Scopes,
+		CreatedAt:  pat.CreatedAt,
+		ExpiresAt:  pat.ExpiresAt,
+		LastUsedAt: pat.LastUsedAt,
+	}
+}
+
+func (repo *Repository) CreatePersonalAccessToken(ctx context.Context, userUUID, tokenHash, prefix string, patReq PersonalAccessTokenCreateRequest) (*PersonalAccessTokenResponse, error) {
+	gormDB, logger := getDBLogger(repo, ctx, CREATE, userUUID)
+	var user *models.User
+	res := gormDB.Where("uuid = ?", userUUID).Find(&user)
+	if err := checkDBError(res); err != nil {
+		logger.Error().Err(err).Msg("failed to find user for personal access token")
+		return nil, err
+	}
+
+	pat := &models.PersonalAccessToken{
+		UUID:      uuid.New().String(),
+		UserID:    user.ID,
+		UserUUID:  user.UUID,
+		Name:      patReq.Name,
+		Prefix:    prefix,
+		TokenHash: tokenHash,
+		Scopes:    patReq.Scopes,
+		ExpiresAt: patReq.ExpiresAt,
+	}
+	if err := checkDBError(gormDB.Create(pat)); err != nil {
+		logger.Error().Err(err).Msg("failed to create personal access token")
+		return nil, err
+	}
+
+	created := newPersonalAccessTokenResponse(pat)
+	return &created, nil
+}
+
+func (repo *Repository) ReadPersonalAccessTokens(ctx context.Context, userUUID string) (*[]PersonalAccessTokenResponse, error) {
+	gormDB, logger := getDBLogger(repo, ctx, READ, userUUID)
+	var pats []models.PersonalAccessToken
+	res := gormDB.
+		Where("user_uuid = ? AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > ?)", userUUID, time.Now()).
+		Order("created_at DESC").
+		Find(&pats)
+	if res.Error != nil {
+		logger.Error().Err(res.Error).Msg("failed to read personal access tokens")
+		return nil, res.Error
+	}
+
+	found := []PersonalAccessTokenResponse{}
+	for i := range pats {
+		found = append(found, newPersonalAccessTokenResponse(&pats[i]))
+	}
+
+	return &found, nil
+}
+
+func (repo *Repository) RevokePersonalAccessToken(ctx context.Context, userUUID, tokenUUID string) error {
+	gormDB, logger := getDBLogger(repo, ctx, UPDATE, userUUID)
+	res := gormDB.Model(&models.PersonalAccessToken{}).
+		Where("user_uuid = ? AND uuid = ? AND revoked_at IS NULL", userUUID, tokenUUID).
+		Update("revoked_at", time.Now())
+	if err := checkDBError(res); err != nil {
+		logger.Error().Err(err).Str("token", tokenUUID).Msg("failed to revoke personal access token")
+		return err
+	}
+
+	return nil
+}
+
+// AuthenticatePersonalAccessToken resolves the hash of a presented personal
+// access token to the principal it acts as.
+func (repo *Repository) AuthenticatePersonalAccessToken(ctx context.Context, tokenHash string) (*auth.Principal, error) {
+	gormDB := repo.gormDB.WithContext(ctx)
+	now := time.Now()
+	var pat *models.PersonalAccessToken
+	res := gormDB.
+		Where("token_hash = ? AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > ?)", tokenHash, now).
+		Find(&pat)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return nil, auth.ErrPersonalAccessTokenInvalid
+	}
+
+	var user *models.User
+	res = gormDB.Where("id = ?", pat.UserID).Find(&user)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return nil, auth.ErrPersonalAccessTokenInvalid
+	}
+
+	if pat.LastUsedAt == nil || now.Sub(*pat.LastUsedAt) > personalAccessTokenTouchInterval {
+		res = gormDB.Model(pat).Update("last_used_at", now)
+		if res.Error != nil {
+			zerolog.Ctx(ctx).Warn().Err(res.Error).Str("token", pat.UUID).Msg("failed to update personal access token last use")
+		}
+	}
+
+	principal := &auth.Principal{
+		UserUUID: user.UUID,
+		Username: user.Username,
+		Role:     user.Role,
+		TokenID:  pat.UUID,
+		Scopes:   pat.Scopes,
+		Method:   auth.AuthMethodPAT,
+		IssuedAt: pat.CreatedAt,
+	}
+	if pat.ExpiresAt != nil {
+		principal.ExpiresAt = *pat.ExpiresAt
+	}
+
+	return principal, nil
+}
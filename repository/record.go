@@ -0,0 +1,318 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rekram1-node/workout-backend/models"
+	"github.com/rekram1-node/workout-backend/strength"
+	"gorm.io/gorm"
+)
+
+const (
+	RecordE1RM          = "e1rm"
+	RecordRepMax        = "rep_max"
+	RecordSessionVolume = "session_volume"
+)
+
+type SetLogRequest struct {
+	UserUUID string `json:"-"`
+	MesoUUID string `json:"-"`
+	Week     int    `json:"-"`
+	Day      string `json:"-"`
+	Lift     int    `json:"-"`
+	// Set is the index of the set, the length of the sets adds a new one
+	Set int `json:"-"`
+	// Version is the version of the meso the set was logged against, 0 for
+	// any
+	Version int `json:"-"`
+
+	Weight float32  `json:"weight" validate:"min=0"`
+	Reps   int      `json:"reps" validate:"min=0"`
+	RIR    *int     `json:"rir" validate:"omitempty,min=0,max=10"`
+	RPE    *float32 `json:"rpe" validate:"omitempty,min=1,max=10"`
+	// Completed defaults to true
+	Completed *bool `json:"completed"`
+}
+
+type SetLogResponse struct {
+	Set  models.Set `json:"set"`
+	E1RM float32    `json:"e1rm"`
+	// NewPR is set when the set beat one of the records of the exercise,
+	// Records are the ones it set
+	NewPR   bool                    `json:"new_pr"`
+	Records []models.PersonalRecord `json:"records"`
+	// Version is the version of the meso with the set logged
+	Version int `json:"version"`
+}
+
+type PersonalRecordsResponse struct {
+	Current []models.PersonalRecord `json:"current"`
+	History []models.PersonalRecord `json:"history"`
+}
+
+// session is where a set was logged
+type session struct {
+	mesoUUID string
+	week     int
+	day      string
+}
+
+// LogSet records what was done in a set of a lift and updates the personal
+// records of the exercise with it.
+func (repo *Repository) LogSet(ctx context.Context, req *SetLogRequest) (*SetLogResponse, error) {
+	res := &SetLogResponse{Records: []models.PersonalRecord{}}
+	meso, err := repo.editMeso(ctx, req.UserUUID, req.MesoUUID, req.Version, func(tx *gorm.DB, meso *models.Meso) error {
+		day, lift, err := findLift(meso, req.Week, req.Day, req.Lift)
+		if err != nil {
+			return err
+		}
+		if req.Set < 0 || req.Set > len(lift.Sets) {
+			return ErrSetNotFound
+		}
+		if req.Set == len(lift.Sets) {
+			lift.Sets = append(lift.Sets, models.Set{})
+		}
+
+		set := &lift.Sets[req.Set]
+		set.Weight = req.Weight
+		set.Reps = req.Reps
+		set.RIR = req.RIR
+		set.RPE = req.RPE
+		set.Completed = req.Completed == nil || *req.Completed
+		if !set.Completed {
+			set.CompletedAt = nil
+		} else if set.CompletedAt == nil {
+			now := time.Now()
+			set.CompletedAt = &now
+		}
+
+		res.Set = *set
+		if !set.Completed {
+			return nil
+		}
+
+		var user *models.User
+		if err := checkDBError(tx.Where("id = ?", meso.UserID).Find(&user)); err != nil {
+			return err
+		}
+		if res.E1RM, err = strength.SetE1RM(user.E1RMFormula, *set); err != nil {
+			return err
+		}
+
+		// catalog IDs are only resolved when the meso is saved, a lift
+		// without one is matched here so its records aren't missed
+		if err := resolveExercises(tx, meso.UserID, meso.Weeks); err != nil {
+			return err
+		}
+		where := session{mesoUUID: meso.UUID, week: req.Week, day: req.Day}
+		records, err := recordPersonalRecords(tx, user, where, day, lift, set)
+		if err != nil {
+			return err
+		}
+		res.Records = records
+		res.NewPR = len(records) > 0
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	res.Version = meso.Version
+	return res, nil
+}
+
+// recordPersonalRecords checks a completed set against the records of its
+// exercise and returns the ones it beat. Beating a record set in the same
+// session replaces it rather than adding to the history.
+func recordPersonalRecords(tx *gorm.DB, user *models.User, where session, day *models.Day, lift *models.Lift, set *models.Set) ([]models.PersonalRecord, error) {
+	records := []models.PersonalRecord{}
+	if lift.ExerciseID == "" {
+		return records, nil
+	}
+
+	e1rm, err := strength.SetE1RM(user.E1RMFormula, *set)
+	if err != nil {
+		return nil, err
+	}
+
+	var volume float32
+	for _, l := range *day.Lifts {
+		if l.ExerciseID != lift.ExerciseID {
+			continue
+		}
+		for _, s := range l.Sets {
+			if s.Completed {
+				volume += s.Weight * float32(s.Reps)
+			}
+		}
+	}
+
+	achievedAt := time.Now()
+	if set.CompletedAt != nil {
+		achievedAt = *set.CompletedAt
+	}
+
+	candidates := []models.PersonalRecord{
+		{Kind: RecordE1RM, Value: e1rm, Formula: user.E1RMFormula},
+		{Kind: RecordRepMax, Reps: set.Reps, Value: set.Weight},
+		{Kind: RecordSessionVolume, Value: volume},
+	}
+	for _, candidate := range candidates {
+		if candidate.Value <= 0 {
+			continue
+		}
+
+		var best models.PersonalRecord
+		res := tx.Where("user_id = ? AND exercise_id = ? AND kind = ? AND reps = ? AND formula = ?",
+			user.ID, lift.ExerciseID, candidate.Kind, candidate.Reps, candidate.Formula).
+			Order("value DESC").
+			Limit(1).
+			Find(&best)
+		if res.Error != nil {
+			return nil, res.Error
+		}
+		if res.RowsAffected > 0 && best.Value >= candidate.Value {
+			continue
+		}
+
+		if res.RowsAffected > 0 && best.MesoUUID == where.mesoUUID && best.Week == where.week && best.Day == where.day {
+			best.Value = candidate.Value
+			best.Exercise = lift.Exercise
+			best.AchievedAt = achievedAt
+			if err := checkDBError(tx.Save(&best)); err != nil {
+				return nil, err
+			}
+			records = append(records, best)
+			continue
+		}
+
+		candidate.UUID = uuid.NewString()
+		candidate.UserID = user.ID
+		candidate.UserUUID = user.UUID
+		candidate.ExerciseID = lift.ExerciseID
+		candidate.Exercise = lift.Exercise
+		candidate.MesoUUID = where.mesoUUID
+		candidate.Week = where.week
+		candidate.Day = where.day
+		candidate.AchievedAt = achievedAt
+		if err := checkDBError(tx.Create(&candidate)); err != nil {
+			return nil, err
+		}
+		records = append(records, candidate)
+	}
+
+	return records, nil
+}
+
+// ReadPersonalRecords returns the current records of every exercise of the
+// user
+func (repo *Repository) ReadPersonalRecords(ctx context.Context, userUUID string) ([]models.PersonalRecord, error) {
+	history, err := repo.readRecordHistory(ctx, userUUID, "")
+	if err != nil {
+		return nil, err
+	}
+
+	return currentRecords(history), nil
+}
+
+// ReadExerciseRecords returns the current records of an exercise along with
+// every record that was set on it, oldest first
+func (repo *Repository) ReadExerciseRecords(ctx context.Context, userUUID, exerciseUUID string) (*PersonalRecordsResponse, error) {
+	history, err := repo.readRecordHistory(ctx, userUUID, exerciseUUID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PersonalRecordsResponse{
+		Current: currentRecords(history),
+		History: history,
+	}, nil
+}
+
+func (repo *Repository) readRecordHistory(ctx context.Context, userUUID, exerciseUUID string) ([]models.PersonalRecord, error) {
+	gormDB, logger := getDBLogger(repo, ctx, READ, userUUID)
+	tx := gormDB.Where("user_uuid = ?", userUUID)
+	if exerciseUUID != "" {
+		tx = tx.Where("exercise_id = ?", exerciseUUID)
+	}
+
+	records := []models.PersonalRecord{}
+	if res := tx.Order("achieved_at, id").Find(&records); res.Error != nil {
+		logger.Error().Err(res.Error).Msg("failed to read personal records")
+		return nil, res.Error
+	}
+
+	return records, nil
+}
+
+// currentRecords picks the best of every exercise, kind, rep count and
+// formula out of history
+func currentRecords(history []models.PersonalRecord) []models.PersonalRecord {
+	type key struct {
+		exercise, kind, formula string
+		reps                    int
+	}
+
+	index := map[key]int{}
+	current := []models.PersonalRecord{}
+	for _, record := range history {
+		k := key{record.ExerciseID, record.Kind, record.Formula, record.Reps}
+		i, ok := index[k]
+		if !ok {
+			index[k] = len(current)
+			current = append(current, record)
+		} else if record.Value > current[i].Value {
+			current[i] = record
+		}
+	}
+
+	return current
+}
+
+// migratePersonalRecords builds the records of every user from the sets that
+// were logged before records were kept
+func migratePersonalRecords(db *gorm.DB) error {
+	var users []models.User
+	return db.FindInBatches(&users, 100, func(tx *gorm.DB, batch int) error {
+		for i := range users {
+			var mesos []models.Meso
+			if res := db.Where("user_id = ?", users[i].ID).Order("created_at").Find(&mesos); res.Error != nil {
+				return res.Error
+			}
+
+			for _, meso := range mesos {
+				if meso.Weeks == nil {
+					continue
+				}
+				for w := range *meso.Weeks {
+					week := &(*meso.Weeks)[w]
+					for d, day := range week.Days() {
+						if day == nil || day.Lifts == nil {
+							continue
+						}
+						where := session{mesoUUID: meso.UUID, week: weekNumber(w, week), day: models.Weekdays[d]}
+						for l := range *day.Lifts {
+							lift := &(*day.Lifts)[l]
+							for s := range lift.Sets {
+								set := &lift.Sets[s]
+								if !set.Completed {
+									continue
+								}
+								if set.CompletedAt == nil {
+									set.CompletedAt = &meso.UpdatedAt
+								}
+								if _, err := recordPersonalRecords(db, &users[i], where, day, lift, set); err != nil {
+									return err
+								}
+							}
+						}
+					}
+				}
+			}
+		}
+		return nil
+	}).Error
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 
+	"github.com/rekram1-node/workout-backend/auth"
 	"github.com/rekram1-node/workout-backend/models"
 	"github.com/rs/zerolog"
 	"gorm.io/driver/postgres"
@@ -11,7 +12,11 @@ import (
 )
 
 type Repository struct {
-	gormDB *gorm.DB
+	gormDB    *gorm.DB
+	passwords auth.PasswordHasher
+	// compared against when a username does not exist so that unknown
+	// users take as long to reject as wrong passwords
+	dummyHash string
 }
 
 const (
@@ -23,7 +28,7 @@ const (
 	UUID      = "uuid"
 )
 
-func New(dbURI string) (*Repository, error) {
+func New(dbURI string, passwords auth.PasswordHasher) (*Repository, error) {
 	db, err := gorm.Open(postgres.Open(dbURI), &gorm.Config{})
 
 	if err != nil {
@@ -33,12 +38,54 @@ func New(dbURI string) (*Repository, error) {
 	if err := db.AutoMigrate(
 		&models.User{},
 		&models.Meso{},
+		&models.Session{},
+		&models.RefreshToken{},
+		&models.RevokedToken{},
+		&models.PersonalAccessToken{},
+		&models.PasswordResetToken{},
+		&models.RecoveryCode{},
+		&models.OutboxMessage{},
+		&models.LoginAttempt{},
+		&models.LoginThrottle{},
+		&models.AuditEvent{},
+		&models.Exercise{},
+		&models.Migration{},
+		&models.VolumeLandmark{},
+		&models.PersonalRecord{},
+		&models.MesoRevision{},
 	); err != nil {
 		return nil, err
 	}
 
+	if err := migrateLegacySets(db); err != nil {
+		return nil, err
+	}
+
+	if err := seedExercises(db); err != nil {
+		return nil, err
+	}
+
+	if err := runOnce(db, "exercise_ids", migrateExerciseIDs); err != nil {
+		return nil, err
+	}
+
+	if err := runOnce(db, "personal_records", migratePersonalRecords); err != nil {
+		return nil, err
+	}
+
+	if err := runOnce(db, "meso_revisions", migrateMesoRevisions); err != nil {
+		return nil, err
+	}
+
+	dummyHash, err := passwords.Hash("dummy-password")
+	if err != nil {
+		return nil, err
+	}
+
 	return &Repository{
-		gormDB: db,
+		gormDB:    db,
+		passwords: passwords,
+		dummyHash: dummyHash,
 	}, nil
 }
 
@@ -0,0 +1,198 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/rekram1-node/workout-backend/auth"
+	"github.com/rekram1-node/workout-backend/jsonpatch"
+	"github.com/rekram1-node/workout-backend/models"
+	"gorm.io/gorm"
+)
+
+var ErrRevisionNotFound = errors.New("meso has no revision with that version")
+
+type MesoRevisionDiff struct {
+	From int `json:"from"`
+	To   int `json:"to"`
+	// Diff is the JSON Patch that turns the meso at From into the meso at To
+	Diff json.RawMessage `json:"diff"`
+}
+
+// revisionContent is what revisions keep of a meso and diff
+type revisionContent struct {
+	Name        string
+	Weeks       *[]models.Week
+	RIRSchedule []int `json:",omitempty"`
+}
+
+func contentOf(meso *models.Meso) ([]byte, error) {
+	return json.Marshal(revisionContent{Name: meso.Name, Weeks: meso.Weeks, RIRSchedule: meso.RIRSchedule})
+}
+
+// recordRevision adds the revision of the version meso is at, before is the
+// content of the version it was changed from, nil for a new meso
+func recordRevision(ctx context.Context, tx *gorm.DB, meso *models.Meso, before []byte) error {
+	after, err := contentOf(meso)
+	if err != nil {
+		return err
+	}
+	if before == nil {
+		before = []byte("{}")
+	}
+	diff, err := jsonpatch.Diff(before, after)
+	if err != nil {
+		return err
+	}
+
+	revision := models.MesoRevision{
+		MesoID:      meso.ID,
+		MesoUUID:    meso.UUID,
+		Version:     meso.Version,
+		AuthorUUID:  meso.UserUUID,
+		CreatedAt:   meso.UpdatedAt,
+		Diff:        diff,
+		Name:        meso.Name,
+		Weeks:       meso.Weeks,
+		RIRSchedule: meso.RIRSchedule,
+	}
+	if principal, ok := auth.PrincipalFromContext(ctx); ok {
+		revision.AuthorUUID = principal.UserUUID
+		revision.ActorUUID = principal.ActorUUID
+	}
+
+	return checkDBError(tx.Create(&revision))
+}
+
+// findMesoID returns the ID of the meso of the user, so its revisions can be
+// looked up
+func findMesoID(tx *gorm.DB, userUUID, mesoUUID string) (uint, error) {
+	var meso models.Meso
+	res := tx.Select("id").Where("user_uuid = ? AND uuid = ?", userUUID, mesoUUID).Find(&meso)
+	if res.Error != nil {
+		return 0, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return 0, fmt.Errorf("%w: no meso with uuid [%s] for user [%s]", ErrMesoNotFound, mesoUUID, userUUID)
+	}
+
+	return meso.ID, nil
+}
+
+func findRevision(tx *gorm.DB, mesoID uint, version int) (*models.MesoRevision, error) {
+	var revision models.MesoRevision
+	res := tx.Where("meso_id = ? AND version = ?", mesoID, version).Find(&revision)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return nil, fmt.Errorf("%w: %d", ErrRevisionNotFound, version)
+	}
+
+	return &revision, nil
+}
+
+// ReadMesoRevisions lists the revisions of a meso, newest first
+func (repo *Repository) ReadMesoRevisions(ctx context.Context, userUUID, mesoUUID string) ([]models.MesoRevision, error) {
+	gormDB, logger := getDBLogger(repo, ctx, READ, userUUID)
+	mesoID, err := findMesoID(gormDB, userUUID, mesoUUID)
+	if err != nil {
+		return nil, err
+	}
+
+	revisions := []models.MesoRevision{}
+	res := gormDB.Omit("weeks").Where("meso_id = ?", mesoID).Order("version DESC").Find(&revisions)
+	if res.Error != nil {
+		logger.Error().Err(res.Error).Str("meso_uuid", mesoUUID).Msg("failed to read meso revisions")
+		return nil, res.Error
+	}
+
+	return revisions, nil
+}
+
+// ReadMesoRevision returns the meso as it was at version
+func (repo *Repository) ReadMesoRevision(ctx context.Context, userUUID, mesoUUID string, version int) (*MesoResponse, error) {
+	gormDB, _ := getDBLogger(repo, ctx, READ, userUUID)
+	mesoID, err := findMesoID(gormDB, userUUID, mesoUUID)
+	if err != nil {
+		return nil, err
+	}
+	revision, err := findRevision(gormDB, mesoID, version)
+	if err != nil {
+		return nil, err
+	}
+
+	return &MesoResponse{
+		Name:        revision.Name,
+		UUID:        revision.MesoUUID,
+		Weeks:       revision.Weeks,
+		RIRSchedule: revision.RIRSchedule,
+		Version:     revision.Version,
+	}, nil
+}
+
+// DiffMesoRevisions returns the JSON Patch between two versions of a meso,
+// from may come after to
+func (repo *Repository) DiffMesoRevisions(ctx context.Context, userUUID, mesoUUID string, from, to int) (*MesoRevisionDiff, error) {
+	gormDB, _ := getDBLogger(repo, ctx, READ, userUUID)
+	mesoID, err := findMesoID(gormDB, userUUID, mesoUUID)
+	if err != nil {
+		return nil, err
+	}
+
+	contents := make([][]byte, 2)
+	for i, version := range []int{from, to} {
+		revision, err := findRevision(gormDB, mesoID, version)
+		if err != nil {
+			return nil, err
+		}
+		content := &models.Meso{Name: revision.Name, Weeks: revision.Weeks, RIRSchedule: revision.RIRSchedule}
+		if contents[i], err = contentOf(content); err != nil {
+			return nil, err
+		}
+	}
+
+	diff, err := jsonpatch.Diff(contents[0], contents[1])
+	if err != nil {
+		return nil, err
+	}
+
+	return &MesoRevisionDiff{From: from, To: to, Diff: diff}, nil
+}
+
+// RestoreMesoRevision puts the meso back the way it was at revision, as a new
+// version so the versions in between are kept
+func (repo *Repository) RestoreMesoRevision(ctx context.Context, userUUID, mesoUUID string, version, revision int) (*MesoResponse, error) {
+	meso, err := repo.editMeso(ctx, userUUID, mesoUUID, version, func(tx *gorm.DB, meso *models.Meso) error {
+		restored, err := findRevision(tx, meso.ID, revision)
+		if err != nil {
+			return err
+		}
+
+		meso.Name = restored.Name
+		meso.Weeks = restored.Weeks
+		meso.RIRSchedule = restored.RIRSchedule
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return mesoResponse(meso), nil
+}
+
+// migrateMesoRevisions records the version every meso is at as its first
+// revision
+func migrateMesoRevisions(db *gorm.DB) error {
+	var mesos []models.Meso
+	return db.Unscoped().FindInBatches(&mesos, 100, func(tx *gorm.DB, batch int) error {
+		for i := range mesos {
+			if err := recordRevision(context.Background(), db, &mesos[i], nil); err != nil {
+				return err
+			}
+		}
+		return nil
+	}).Error
+}
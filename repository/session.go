@@ -0,0 +1,148 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/rekram1-node/workout-backend/models"
+	"gorm.io/gorm"
+)
+
+type SessionCreateRequest struct {
+	UUID        string
+	DeviceLabel string
+	UserAgent   string
+	IP          string
+	TokenHash   string
+	ExpiresAt   time.Time
+}
+
+// CreateSession records a new sign in along with the first refresh token of
+// its family.
+func (repo *Repository) CreateSession(ctx context.Context, user *models.User, sessionReq SessionCreateRequest) error {
+	gormDB, logger := getDBLogger(repo, ctx, CREATE, user.UUID)
+	dberr := gormDB.Transaction(func(tx *gorm.DB) error {
+		session := &models.Session{
+			UserID:      user.ID,
+			UserUUID:    user.UUID,
+			UUID:        sessionReq.UUID,
+			DeviceLabel: sessionReq.DeviceLabel,
+			UserAgent:   sessionReq.UserAgent,
+			IP:          sessionReq.IP,
+			LastUsedAt:  time.Now(),
+			ExpiresAt:   sessionReq.ExpiresAt,
+		}
+		refreshToken := &models.RefreshToken{
+			UserID:    user.ID,
+			UserUUID:  user.UUID,
+			FamilyID:  sessionReq.UUID,
+			TokenHash: sessionReq.TokenHash,
+			ExpiresAt: sessionReq.ExpiresAt,
+		}
+
+		for _, obj := range []interface{}{session, refreshToken} {
+			if err := checkDBError(tx.Create(obj)); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+
+	if dberr != nil {
+		logger.Error().Err(dberr).Msg("failed to create session")
+		return dberr
+	}
+
+	return nil
+}
+
+type SessionResponse struct {
+	ID          string    `json:"id"`
+	DeviceLabel string    `json:"device_label"`
+	UserAgent   string    `json:"user_agent"`
+	IP          string    `json:"ip"`
+	CreatedAt   time.Time `json:"created_at"`
+	LastUsedAt  time.Time `json:"last_used_at"`
+	Current     bool      `json:"current"`
+}
+
+func (repo *Repository) ReadSessions(ctx context.Context, userUUID string) (*[]SessionResponse, error) {
+	gormDB, logger := getDBLogger(repo, ctx, READ, userUUID)
+	var sessions []models.Session
+	res := gormDB.
+		Where("user_uuid = ? AND revoked_at IS NULL AND expires_at > ?", userUUID, time.Now()).
+		Order("last_used_at DESC").
+		Find(&sessions)
+	if res.Error != nil {
+		logger.Error().Err(res.Error).Msg("failed to read sessions")
+		return nil, res.Error
+	}
+
+	found := []SessionResponse{}
+	for _, session := range sessions {
+		found = append(found, SessionResponse{
+			ID:          session.UUID,
+			DeviceLabel: session.DeviceLabel,
+			UserAgent:   session.UserAgent,
+			IP:          session.IP,
+			CreatedAt:   session.CreatedAt,
+			LastUsedAt:  session.LastUsedAt,
+		})
+	}
+
+	return &found, nil
+}
+
+// RevokeSession revokes a session of the user and every refresh token issued
+// for it. Access tokens carry the session in their sid claim and are rejected
+// once it is revoked.
+func (repo *Repository) RevokeSession(ctx context.Context, userUUID, sessionUUID string) error {
+	gormDB, logger := getDBLogger(repo, ctx, UPDATE, userUUID)
+	logger = logger.With().Str("session", sessionUUID).Logger()
+	dberr := gormDB.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		res := tx.Model(&models.Session{}).
+			Where("user_uuid = ? AND uuid = ? AND revoked_at IS NULL", userUUID, sessionUUID).
+			Update("revoked_at", now)
+		if err := checkDBError(res); err != nil {
+			return err
+		}
+
+		return tx.Model(&models.RefreshToken{}).
+			Where("user_uuid = ? AND family_id = ? AND revoked_at IS NULL", userUUID, sessionUUID).
+			Update("revoked_at", now).Error
+	})
+
+	if dberr != nil {
+		logger.Error().Err(dberr).Msg("failed to revoke session")
+		return dberr
+	}
+
+	return nil
+}
+
+// RevokeOtherSessions revokes every session of the user except keepSessionUUID
+func (repo *Repository) RevokeOtherSessions(ctx context.Context, userUUID, keepSessionUUID string) error {
+	gormDB, logger := getDBLogger(repo, ctx, UPDATE, userUUID)
+	dberr := gormDB.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		res := tx.Model(&models.Session{}).
+			Where("user_uuid = ? AND uuid <> ? AND revoked_at IS NULL", userUUID, keepSessionUUID).
+			Update("revoked_at", now)
+		if res.Error != nil {
+			return res.Error
+		}
+
+		return tx.Model(&models.RefreshToken{}).
+			Where("user_uuid = ? AND family_id <> ? AND revoked_at IS NULL", userUUID, keepSessionUUID).
+			Update("revoked_at", now).Error
+	})
+
+	if dberr != nil {
+		logger.Error().Err(dberr).Msg("failed to revoke other sessions")
+		return dberr
+	}
+
+	return nil
+}
@@ -0,0 +1,197 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/rekram1-node/workout-backend/auth"
+	"github.com/rekram1-node/workout-backend/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrRefreshTokenInvalid = errors.New("invalid refresh token")
+	ErrRefreshTokenExpired = errors.New("refresh token expired")
+	ErrRefreshTokenReused  = errors.New("refresh token reused, all tokens in its family have been revoked")
+)
+
+// RotateRefreshToken exchanges the refresh token stored under tokenHash for a
+// new one stored under newTokenHash and returns the owning user and session.
+// A token that was already rotated is treated as stolen and its whole session
+// is revoked.
+func (repo *Repository) RotateRefreshToken(ctx context.Context, tokenHash, newTokenHash string, expiresAt time.Time) (*models.User, string, error) {
+	gormDB := repo.gormDB.WithContext(ctx)
+	var user *models.User
+	var current models.RefreshToken
+	reused := false
+
+	dberr := gormDB.Transaction(func(tx *gorm.DB) error {
+		res := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("token_hash = ?", tokenHash).
+			Find(&current)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrRefreshTokenInvalid
+		}
+
+		now := time.Now()
+		switch {
+		case current.RevokedAt != nil:
+			return ErrRefreshTokenInvalid
+		case current.RotatedAt != nil:
+			reused = true
+			return nil
+		case now.After(current.ExpiresAt):
+			return ErrRefreshTokenExpired
+		}
+
+		res = tx.Model(&current).Update("rotated_at", now)
+		if err := checkDBError(res); err != nil {
+			return err
+		}
+
+		res = tx.Model(&models.Session{}).
+			Where("uuid = ? AND revoked_at IS NULL", current.FamilyID).
+			Updates(map[string]interface{}{
+				"last_used_at": now,
+				"expires_at":   expiresAt,
+			})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrRefreshTokenInvalid
+		}
+
+		// deleted users can't refresh, their tokens are left to be purged
+		res = tx.Where("id = ?", current.UserID).Find(&user)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrRefreshTokenInvalid
+		}
+
+		next := &models.RefreshToken{
+			UserID:    current.UserID,
+			UserUUID:  current.UserUUID,
+			FamilyID:  current.FamilyID,
+			TokenHash: newTokenHash,
+			ExpiresAt: expiresAt,
+		}
+
+		return checkDBError(tx.Create(next))
+	})
+
+	if reused {
+		_, logger := getDBLogger(repo, ctx, UPDATE, current.UserUUID)
+		logger.Warn().Str("session", current.FamilyID).Msg("rotated refresh token presented again, revoking session")
+		if err := repo.RevokeSession(ctx, current.UserUUID, current.FamilyID); err != nil {
+			return nil, "", err
+		}
+
+		return nil, "", ErrRefreshTokenReused
+	}
+
+	if dberr != nil {
+		return nil, "", dberr
+	}
+
+	return user, current.FamilyID, nil
+}
+
+func (repo *Repository) RevokeAccessToken(ctx context.Context, userUUID, tokenID string, expiresAt time.Time) error {
+	gormDB, logger := getDBLogger(repo, ctx, CREATE, userUUID)
+	revoked := &models.RevokedToken{
+		UserUUID:  userUUID,
+		TokenID:   tokenID,
+		ExpiresAt: expiresAt,
+	}
+
+	res := gormDB.Clauses(clause.OnConflict{DoNothing: true}).Create(revoked)
+	if res.Error != nil {
+		logger.Error().Err(res.Error).Str("token_id", tokenID).Msg("failed to revoke access token")
+		return res.Error
+	}
+
+	return nil
+}
+
+// RevokeAllTokens revokes every session, refresh token and personal access
+// token of the user and every access token issued up to now.
+func (repo *Repository) RevokeAllTokens(ctx context.Context, userUUID string) error {
+	gormDB, logger := getDBLogger(repo, ctx, UPDATE, userUUID)
+	dberr := gormDB.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		res := tx.Model(&models.User{}).
+			Where("uuid = ?", userUUID).
+			Update("tokens_revoked_at", now)
+		if err := checkDBError(res); err != nil {
+			return err
+		}
+
+		res = tx.Model(&models.Session{}).
+			Where("user_uuid = ? AND revoked_at IS NULL", userUUID).
+			Update("revoked_at", now)
+		if res.Error != nil {
+			return res.Error
+		}
+
+		res = tx.Model(&models.RefreshToken{}).
+			Where("user_uuid = ? AND revoked_at IS NULL", userUUID).
+			Update("revoked_at", now)
+		if res.Error != nil {
+			return res.Error
+		}
+
+		return tx.Model(&models.PersonalAccessToken{}).
+			Where("user_uuid = ? AND revoked_at IS NULL", userUUID).
+			Update("revoked_at", now).Error
+	})
+
+	if dberr != nil {
+		logger.Error().Err(dberr).Msg("failed to revoke all tokens")
+		return dberr
+	}
+
+	return nil
+}
+
+func (repo *Repository) IsTokenRevoked(ctx context.Context, principal *auth.Principal) (bool, error) {
+	gormDB := repo.gormDB.WithContext(ctx)
+	var count int64
+	res := gormDB.Model(&models.RevokedToken{}).Where("token_id = ?", principal.TokenID).Count(&count)
+	if res.Error != nil {
+		return false, res.Error
+	}
+	if count > 0 {
+		return true, nil
+	}
+
+	if principal.SessionID != "" {
+		res = gormDB.Model(&models.Session{}).
+			Where("uuid = ? AND revoked_at IS NOT NULL", principal.SessionID).
+			Count(&count)
+		if res.Error != nil {
+			return false, res.Error
+		}
+		if count > 0 {
+			return true, nil
+		}
+	}
+
+	// iat only has second precision, so anything issued in the same second
+	// as a sign out of every session is treated as revoked
+	res = gormDB.Model(&models.User{}).
+		Where("uuid = ? AND tokens_revoked_at IS NOT NULL AND tokens_revoked_at >= ?", principal.UserUUID, principal.IssuedAt.Truncate(time.Second)).
+		Count(&count)
+	if res.Error != nil {
+		return false, res.Error
+	}
+
+	return count > 0, nil
+}
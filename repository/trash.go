@@ -0,0 +1,257 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/rekram1-node/workout-backend/models"
+	"github.com/rekram1-node/workout-backend/throttle"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var ErrMesoNotDeleted = errors.New("meso is not deleted")
+
+// TrashedMeso is a deleted meso that can still be restored
+type TrashedMeso struct {
+	Name      string
+	UUID      string
+	Version   int
+	DeletedAt time.Time
+}
+
+type UndoDeleteRequest struct {
+	Username string `json:"username" validate:"required"`
+	Password string `json:"password" validate:"required"`
+	// Code is a TOTP or recovery code, needed when two factor is enabled
+	Code string `json:"code"`
+}
+
+// ReadTrashedMesos lists the deleted mesos of the user, most recently deleted
+// first
+func (repo *Repository) ReadTrashedMesos(ctx context.Context, userUUID string) ([]TrashedMeso, error) {
+	gormDB, logger := getDBLogger(repo, ctx, READ, userUUID)
+	var mesos []models.Meso
+	res := gormDB.Unscoped().
+		Select("name", "uuid", "version", "deleted_at").
+		Where("user_uuid = ? AND deleted_at IS NOT NULL", userUUID).
+		Order("deleted_at DESC").
+		Find(&mesos)
+	if res.Error != nil {
+		logger.Error().Err(res.Error).Msg("failed to read trashed mesos")
+		return nil, res.Error
+	}
+
+	trashed := []TrashedMeso{}
+	for _, meso := range mesos {
+		trashed = append(trashed, TrashedMeso{
+			Name:      meso.Name,
+			UUID:      meso.UUID,
+			Version:   meso.Version,
+			DeletedAt: meso.DeletedAt.Time,
+		})
+	}
+
+	return trashed, nil
+}
+
+// RestoreMeso takes a meso out of the trash as a new version, so the restore
+// shows up in its revisions
+func (repo *Repository) RestoreMeso(ctx context.Context, userUUID, mesoUUID string) (*MesoResponse, error) {
+	gormDB, logger := getDBLogger(repo, ctx, UPDATE, userUUID)
+	logger = logger.With().Str("meso_uuid", mesoUUID).Logger()
+	var meso models.Meso
+	dberr := gormDB.Transaction(func(tx *gorm.DB) error {
+		res := tx.Unscoped().Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("user_uuid = ? AND uuid = ?", userUUID, mesoUUID).
+			Find(&meso)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return fmt.Errorf("%w: no meso with uuid [%s] for user [%s]", ErrMesoNotFound, mesoUUID, userUUID)
+		}
+		if !meso.DeletedAt.Valid {
+			return ErrMesoNotDeleted
+		}
+
+		before, err := contentOf(&meso)
+		if err != nil {
+			return err
+		}
+
+		meso.DeletedAt = gorm.DeletedAt{}
+		meso.Version++
+		if err := checkDBError(tx.Unscoped().Model(&meso).Select("deleted_at", "version", "updated_at").Updates(&meso)); err != nil {
+			return err
+		}
+		return recordRevision(ctx, tx, &meso, before)
+	})
+
+	if dberr != nil {
+		logger.Info().Err(dberr).Msg("failed to restore meso")
+		return nil, dberr
+	}
+
+	logger.Info().Msg("restored meso")
+	return mesoResponse(&meso), nil
+}
+
+// restoreUser undoes the deletion of a user along with the mesos that were
+// deleted with them
+func restoreUser(tx *gorm.DB, user *models.User) error {
+	// DeleteUser stamps the user and their mesos with the same deleted_at
+	res := tx.Unscoped().Model(&models.Meso{}).
+		Where("user_id = ? AND deleted_at = ?", user.ID, user.DeletedAt.Time).
+		Update("deleted_at", nil)
+	if res.Error != nil {
+		return res.Error
+	}
+
+	return checkDBError(tx.Unscoped().Model(user).Update("deleted_at", nil))
+}
+
+// UndoDeleteUser restores an account deleted less than grace ago for whoever
+// holds its credentials. Accounts past their grace period fail like wrong
+// credentials, they are about to be purged.
+func (repo *Repository) UndoDeleteUser(ctx context.Context, req UndoDeleteRequest, grace time.Duration) (*models.User, error) {
+	gormDB, logger := getDBLogger(repo, ctx, UPDATE, "")
+	logger = logger.With().Str("user", req.Username).Logger()
+	var user *models.User
+	dberr := gormDB.Transaction(func(tx *gorm.DB) error {
+		res := tx.Unscoped().
+			Where("username = ? AND deleted_at > ?", req.Username, time.Now().Add(-grace)).
+			Find(&user)
+		if err := checkDBError(res); err != nil {
+			_, _ = repo.passwords.Verify(req.Password, repo.dummyHash)
+			return err
+		}
+
+		ok, err := repo.passwords.Verify(req.Password, user.Password)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return fmt.Errorf("invalid credentials")
+		}
+
+		if err := restoreUser(tx, user); err != nil {
+			return err
+		}
+		// the code is checked against the restored user, a wrong one rolls
+		// the restore back
+		if user.MFAEnabled {
+			if _, err := verifyMFA(tx, user.UUID, req.Code); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+
+	if dberr != nil {
+		logger.Info().Err(dberr).Msg("failed to undo user deletion")
+		return nil, dberr
+	}
+
+	logger.Info().Str("user_uuid", user.UUID).Msg("undid user deletion")
+	return user, nil
+}
+
+// PurgeDeleted hard deletes mesos that have been in the trash for longer than
+// mesoRetention and accounts deleted longer than accountGrace ago, along with
+// everything that belongs to them.
+func (repo *Repository) PurgeDeleted(ctx context.Context, mesoRetention, accountGrace time.Duration) error {
+	gormDB, logger := getDBLogger(repo, ctx, DELETE, "")
+	now := time.Now()
+
+	var users []models.User
+	res := gormDB.Unscoped().
+		Where("deleted_at < ?", now.Add(-accountGrace)).
+		Find(&users)
+	if res.Error != nil {
+		return res.Error
+	}
+	for i := range users {
+		if err := gormDB.Transaction(func(tx *gorm.DB) error {
+			return purgeUser(tx, &users[i])
+		}); err != nil {
+			return fmt.Errorf("failed to purge user %s: %w", users[i].UUID, err)
+		}
+		logger.Info().Str("user_uuid", users[i].UUID).Msg("purged deleted user")
+	}
+
+	var mesoIDs []uint
+	res = gormDB.Unscoped().Model(&models.Meso{}).
+		Where("deleted_at < ?", now.Add(-mesoRetention)).
+		Pluck("id", &mesoIDs)
+	if res.Error != nil {
+		return res.Error
+	}
+	if len(mesoIDs) == 0 {
+		return nil
+	}
+	err := gormDB.Transaction(func(tx *gorm.DB) error {
+		return purgeMesos(tx, mesoIDs)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to purge mesos: %w", err)
+	}
+
+	logger.Info().Int("mesos", len(mesoIDs)).Msg("purged deleted mesos")
+	return nil
+}
+
+func purgeMesos(tx *gorm.DB, mesoIDs []uint) error {
+	if res := tx.Where("meso_id IN ?", mesoIDs).Delete(&models.MesoRevision{}); res.Error != nil {
+		return res.Error
+	}
+
+	return tx.Unscoped().Where("id IN ?", mesoIDs).Delete(&models.Meso{}).Error
+}
+
+func purgeUser(tx *gorm.DB, user *models.User) error {
+	var mesoIDs []uint
+	if res := tx.Unscoped().Model(&models.Meso{}).Where("user_id = ?", user.ID).Pluck("id", &mesoIDs); res.Error != nil {
+		return res.Error
+	}
+	if len(mesoIDs) > 0 {
+		if err := purgeMesos(tx, mesoIDs); err != nil {
+			return err
+		}
+	}
+
+	for _, owned := range []interface{}{
+		&models.PersonalRecord{},
+		&models.VolumeLandmark{},
+		&models.Exercise{},
+		&models.Session{},
+		&models.RefreshToken{},
+		&models.PersonalAccessToken{},
+		&models.PasswordResetToken{},
+		&models.RecoveryCode{},
+	} {
+		if res := tx.Unscoped().Where("user_id = ?", user.ID).Delete(owned); res.Error != nil {
+			return res.Error
+		}
+	}
+
+	// rows kept by username or uuid rather than user_id, the messages hold
+	// reset codes and the attempts and throttle state the username
+	if res := tx.Unscoped().Where("user_uuid = ?", user.UUID).Delete(&models.RevokedToken{}); res.Error != nil {
+		return res.Error
+	}
+	if res := tx.Unscoped().Where("recipient = ?", user.Username).Delete(&models.OutboxMessage{}); res.Error != nil {
+		return res.Error
+	}
+	if res := tx.Unscoped().Where("username = ?", user.Username).Delete(&models.LoginAttempt{}); res.Error != nil {
+		return res.Error
+	}
+	if res := tx.Where("key = ?", throttle.UsernameKey(user.Username)).Delete(&models.LoginThrottle{}); res.Error != nil {
+		return res.Error
+	}
+
+	return tx.Unscoped().Delete(user).Error
+}
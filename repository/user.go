@@ -4,9 +4,12 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/rekram1-node/workout-backend/auth"
 	"github.com/rekram1-node/workout-backend/models"
+	"github.com/rekram1-node/workout-backend/strength"
 	"github.com/rs/zerolog"
 	"gorm.io/gorm"
 )
@@ -14,24 +17,60 @@ import (
 type UserSignInRequest struct {
 	Username string `json:"username" validate:"required"`
 	Password string `json:"password" validate:"required"`
+	// Device optionally labels the session, defaults to one derived from the user agent
+	Device string `json:"device" validate:"max=64"`
 }
 
 func (repo *Repository) FindUserByCredentials(ctx context.Context, signInRequest UserSignInRequest) (*models.User, error) {
 	logger := zerolog.Ctx(ctx).With().Str("user", signInRequest.Username).Logger()
-	user := &models.User{
-		Username: signInRequest.Username,
-		Password: signInRequest.Password,
-	}
-	res := repo.gormDB.WithContext(ctx).Where("username = ? AND password = ?", signInRequest.Username, signInRequest.Password).
+	var user *models.User
+	res := repo.gormDB.WithContext(ctx).Where("username = ?", signInRequest.Username).
 		Find(&user)
 	if err := checkDBError(res); err != nil {
 		logger.Error().Err(err).Msg("unable to find user")
+		_, _ = repo.passwords.Verify(signInRequest.Password, repo.dummyHash)
 		return nil, err
 	}
 
+	ok, err := repo.passwords.Verify(signInRequest.Password, user.Password)
+	if err != nil {
+		logger.Error().Err(err).Msg("unable to verify password")
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("invalid credentials")
+	}
+
+	if repo.passwords.NeedsRehash(user.Password) {
+		repo.rehashPassword(ctx, user, signInRequest.Password)
+	}
+
 	return user, nil
 }
 
+// rehashPassword upgrades a stored hash (or a legacy plaintext password) to
+// the current algorithm and parameters. Failure is logged but does not fail
+// the sign in, the upgrade is simply retried next time.
+func (repo *Repository) rehashPassword(ctx context.Context, user *models.User, password string) {
+	gormDB, logger := getDBLogger(repo, ctx, UPDATE, user.UUID)
+	hash, err := repo.passwords.Hash(password)
+	if err != nil {
+		logger.Error().Err(err).Msg("failed to rehash password")
+		return
+	}
+
+	res := gormDB.Model(&models.User{}).
+		Where("id = ? AND password = ?", user.ID, user.Password).
+		Update("password", hash)
+	if err := checkDBError(res); err != nil {
+		logger.Error().Err(err).Msg("failed to store rehashed password")
+		return
+	}
+
+	user.Password = hash
+	logger.Info().Msg("upgraded stored password hash")
+}
+
 type UserCreateRequest struct {
 	Username string `json:"username" validate:"required"`
 	Password string `json:"password" validate:"required"`
@@ -39,11 +78,20 @@ type UserCreateRequest struct {
 
 func (repo *Repository) CreateUser(ctx context.Context, userRequest UserCreateRequest) (*models.User, error) {
 	user := &models.User{
-		UUID:     uuid.New().String(),
-		Username: userRequest.Username,
-		Password: userRequest.Password,
+		UUID:        uuid.New().String(),
+		Username:    userRequest.Username,
+		Role:        auth.RoleUser,
+		E1RMFormula: strength.Default,
 	}
 	gormDB, logger := getDBLogger(repo, ctx, CREATE, user.UUID)
+
+	hash, err := repo.passwords.Hash(userRequest.Password)
+	if err != nil {
+		logger.Error().Err(err).Msg("failed to hash password")
+		return nil, err
+	}
+	user.Password = hash
+
 	dberr := gormDB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
 		for _, obj := range []interface{}{user} {
 			if err := checkDBError(tx.WithContext(ctx).Debug().Create(obj)); err != nil {
@@ -86,7 +134,6 @@ func (repo *Repository) DeleteUser(ctx context.Context, uuid string) error {
 	dberr := gormDB.Transaction(func(tx *gorm.DB) error {
 		tx = tx.WithContext(ctx)
 		var user *models.User
-		var mesoIDs []uint
 
 		dbUsr := tx.Where("uuid = ?", uuid).
 			Take(&user)
@@ -95,28 +142,18 @@ func (repo *Repository) DeleteUser(ctx context.Context, uuid string) error {
 			return err
 		}
 
-		dbMesoResult := tx.Model(&models.Meso{}).
+		// the user and the mesos deleted with them share deleted_at, so
+		// undoing it leaves mesos that were already in the trash there
+		now := time.Now()
+		resultDeleteMesos := tx.Model(&models.Meso{}).
 			Where("user_id = ?", user.ID).
-			Pluck("id", &mesoIDs)
-		if err := checkDBError(dbMesoResult); err != nil {
-			logger.Error().Err(err).Msg("unable to lookup user meso uuids")
-			return err
+			Update("deleted_at", now)
+		if resultDeleteMesos.Error != nil {
+			logger.Error().Err(resultDeleteMesos.Error).Msg("database error deleting user mesos")
+			return resultDeleteMesos.Error
 		}
 
-		for _, mesoID := range mesoIDs {
-			resultDeleteMeso := tx.Model(&models.Meso{}).
-				Where("id = ?", mesoID).
-				Delete(&models.Meso{})
-			if err := checkDBError(resultDeleteMeso); err != nil {
-				logger.Error().Err(err).Uint("meso_id", mesoID).Msg("database error deleting meso")
-				return err
-			}
-		}
-
-		resultDelete := tx.
-			Select("Mesos").
-			Where("id = ?", user.ID).
-			Delete(&user)
+		resultDelete := tx.Model(user).Update("deleted_at", now)
 		if err := checkDBError(resultDelete); err != nil {
 			logger.Error().Err(err).Msg("database error deleting user")
 			return err
@@ -133,10 +170,11 @@ func (repo *Repository) DeleteUser(ctx context.Context, uuid string) error {
 	return nil
 }
 
+// UserUpdateRequest changes profile fields, passwords are changed through
+// ChangePassword so the current password is always checked.
 type UserUpdateRequest struct {
-	UUID     uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4();primary_key"`
-	Username string    `json:"username" gorm:"uniqueIndex;not null" validate:"required"`
-	Password string    `json:"password" validate:"required"`
+	Username    string `json:"username" gorm:"uniqueIndex;not null" validate:"required_without=E1RMFormula"`
+	E1RMFormula string `json:"e1rm_formula" validate:"omitempty,oneof=epley brzycki rpe"`
 }
 
 func (repo *Repository) UpdateUser(ctx context.Context, uuid string, userUpdate UserUpdateRequest) error {
@@ -148,10 +186,13 @@ func (repo *Repository) UpdateUser(ctx context.Context, uuid string, userUpdate
 		if userUpdate.Username != "" {
 			updates["username"] = userUpdate.Username
 		}
+		if userUpdate.E1RMFormula != "" {
+			updates["e1rm_formula"] = userUpdate.E1RMFormula
+		}
 
 		res := tx.WithContext(ctx).
 			Model(&user).
-			Where("uuid = ?", userUpdate.UUID).
+			Where("uuid = ?", uuid).
 			Updates(updates)
 		if err := checkDBError(res); err != nil {
 			logger.Error().Err(err).Msg("error updating user metadata")
@@ -168,3 +209,22 @@ func (repo *Repository) UpdateUser(ctx context.Context, uuid string, userUpdate
 
 	return nil
 }
+
+// AssignRole gives every user in usernames role, usernames that don't exist
+// are skipped.
+func (repo *Repository) AssignRole(ctx context.Context, role string, usernames []string) error {
+	if len(usernames) == 0 {
+		return nil
+	}
+
+	gormDB, logger := getDBLogger(repo, ctx, UPDATE, "")
+	res := gormDB.Model(&models.User{}).
+		Where("username IN ? AND role <> ?", usernames, role).
+		Update("role", role)
+	if res.Error != nil {
+		logger.Error().Err(res.Error).Str("role", role).Msg("failed to assign role")
+		return res.Error
+	}
+
+	return nil
+}
@@ -0,0 +1,129 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/rekram1-node/workout-backend/models"
+	"github.com/rekram1-node/workout-backend/volume"
+	"gorm.io/gorm"
+)
+
+type VolumeLandmarkRequest struct {
+	Muscle string `json:"muscle" validate:"required,muscle"`
+	MEV    int    `json:"mev" validate:"min=0,max=100"`
+	MAV    int    `json:"mav" validate:"gtefield=MEV,max=100"`
+	MRV    int    `json:"mrv" validate:"gtefield=MAV,max=100"`
+}
+
+type VolumeLandmarksRequest struct {
+	Landmarks []VolumeLandmarkRequest `json:"landmarks" validate:"max=32,unique=Muscle,dive"`
+}
+
+type MesoVolumeResponse struct {
+	UUID            string        `json:"uuid"`
+	Name            string        `json:"name"`
+	SecondaryCredit float64       `json:"secondary_credit"`
+	Weeks           []volume.Week `json:"weeks"`
+}
+
+func (repo *Repository) ReadVolumeLandmarks(ctx context.Context, userUUID string) ([]models.VolumeLandmark, error) {
+	gormDB, logger := getDBLogger(repo, ctx, READ, userUUID)
+	landmarks := []models.VolumeLandmark{}
+	if res := gormDB.Where("user_uuid = ?", userUUID).Order("id").Find(&landmarks); res.Error != nil {
+		logger.Error().Err(res.Error).Msg("failed to read volume landmarks")
+		return nil, res.Error
+	}
+
+	return landmarks, nil
+}
+
+// SetVolumeLandmarks replaces every landmark of the user with the ones in the
+// request, muscles left out have none
+func (repo *Repository) SetVolumeLandmarks(ctx context.Context, userUUID string, req *VolumeLandmarksRequest) ([]models.VolumeLandmark, error) {
+	gormDB, logger := getDBLogger(repo, ctx, UPDATE, userUUID)
+	dberr := gormDB.Transaction(func(tx *gorm.DB) error {
+		var user *models.User
+		res := tx.Where("uuid = ?", userUUID).Find(&user)
+		if err := checkDBError(res); err != nil {
+			return err
+		}
+
+		if res := tx.Unscoped().Where("user_id = ?", user.ID).Delete(&models.VolumeLandmark{}); res.Error != nil {
+			return res.Error
+		}
+		if len(req.Landmarks) == 0 {
+			return nil
+		}
+
+		landmarks := make([]models.VolumeLandmark, 0, len(req.Landmarks))
+		for _, landmark := range req.Landmarks {
+			landmarks = append(landmarks, models.VolumeLandmark{
+				UserID:   user.ID,
+				UserUUID: user.UUID,
+				Muscle:   landmark.Muscle,
+				MEV:      landmark.MEV,
+				MAV:      landmark.MAV,
+				MRV:      landmark.MRV,
+			})
+		}
+
+		return checkDBError(tx.Create(&landmarks))
+	})
+
+	if dberr != nil {
+		logger.Error().Err(dberr).Msg("failed to set volume landmarks")
+		return nil, dberr
+	}
+
+	return repo.ReadVolumeLandmarks(ctx, userUUID)
+}
+
+// ReadMesoVolume counts the sets per muscle group of every week of the meso,
+// secondary muscles get secondaryCredit of a set
+func (repo *Repository) ReadMesoVolume(ctx context.Context, userUUID, mesoUUID string, secondaryCredit float64) (*MesoVolumeResponse, error) {
+	gormDB, logger := getDBLogger(repo, ctx, READ, userUUID)
+	logger = logger.With().Str("meso_uuid", mesoUUID).Logger()
+	var meso *models.Meso
+	res := gormDB.Where("user_uuid = ? AND uuid = ?", userUUID, mesoUUID).Find(&meso)
+	if res.Error != nil {
+		logger.Error().Err(res.Error).Msg("failed to find meso")
+		return nil, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return nil, fmt.Errorf("%w: no meso with uuid [%s] for user [%s]", ErrMesoNotFound, mesoUUID, userUUID)
+	}
+
+	// deleted custom exercises still count for the lifts that use them
+	var exercises []models.Exercise
+	res = gormDB.Unscoped().Where("user_id IS NULL OR user_id = ?", meso.UserID).Find(&exercises)
+	if res.Error != nil {
+		logger.Error().Err(res.Error).Msg("failed to read exercises")
+		return nil, res.Error
+	}
+	byID := make(map[string]*models.Exercise, len(exercises))
+	for i := range exercises {
+		byID[exercises[i].UUID] = &exercises[i]
+	}
+
+	landmarks, err := repo.ReadVolumeLandmarks(ctx, userUUID)
+	if err != nil {
+		return nil, err
+	}
+	byMuscle := make(map[string]volume.Landmarks, len(landmarks))
+	for _, landmark := range landmarks {
+		byMuscle[landmark.Muscle] = volume.Landmarks{MEV: landmark.MEV, MAV: landmark.MAV, MRV: landmark.MRV}
+	}
+
+	response := &MesoVolumeResponse{
+		UUID:            meso.UUID,
+		Name:            meso.Name,
+		SecondaryCredit: secondaryCredit,
+		Weeks:           []volume.Week{},
+	}
+	if meso.Weeks != nil {
+		response.Weeks = volume.Weekly(*meso.Weeks, byID, byMuscle, secondaryCredit)
+	}
+
+	return response, nil
+}
@@ -0,0 +1,105 @@
+// Package strength estimates one rep maxes from logged sets.
+package strength
+
+import (
+	"errors"
+	"math"
+
+	"github.com/rekram1-node/workout-backend/models"
+)
+
+// Formulas
+const (
+	Epley   = "epley"
+	Brzycki = "brzycki"
+	// RPE looks the set up in an RPE chart, which takes the reps left in
+	// reserve into account
+	RPE     = "rpe"
+	Default = Epley
+)
+
+var ErrUnknownFormula = errors.New("unknown e1RM formula")
+
+// rpeChart is the share of 1RM a set to failure is done with, by reps to
+// failure (reps + RIR) in half reps starting at 1
+var rpeChart = []float64{
+	1.000, 0.978, 0.955, 0.939, 0.922, 0.907, 0.892, 0.878, 0.863, 0.850,
+	0.837, 0.824, 0.811, 0.799, 0.786, 0.774, 0.762, 0.751, 0.739, 0.723,
+	0.707, 0.694, 0.680,
+}
+
+// E1RM estimates the one rep max from a set of reps with weight. rir is the
+// reps left in reserve, only the RPE formula uses it and counts a set without
+// one as taken to failure. Sets past the range of a formula are estimated
+// with Epley.
+func E1RM(formula string, weight float32, reps int, rir *float32) (float32, error) {
+	if formula == "" {
+		formula = Default
+	}
+	estimate, ok := formulas[formula]
+	if !ok {
+		return 0, ErrUnknownFormula
+	}
+	if reps < 1 || weight <= 0 {
+		return 0, nil
+	}
+
+	e1rm, ok := estimate(float64(weight), reps, rir)
+	if !ok {
+		e1rm, _ = epley(float64(weight), reps, rir)
+	}
+
+	return float32(math.Round(e1rm*10) / 10), nil
+}
+
+// SetE1RM estimates the one rep max from the weight and reps logged in set,
+// with the effort logged as RIR or RPE
+func SetE1RM(formula string, set models.Set) (float32, error) {
+	var rir *float32
+	switch {
+	case set.RIR != nil:
+		r := float32(*set.RIR)
+		rir = &r
+	case set.RPE != nil:
+		r := 10 - *set.RPE
+		rir = &r
+	}
+
+	return E1RM(formula, set.Weight, set.Reps, rir)
+}
+
+var formulas = map[string]func(weight float64, reps int, rir *float32) (float64, bool){
+	Epley:   epley,
+	Brzycki: brzycki,
+	RPE:     rpe,
+}
+
+func epley(weight float64, reps int, _ *float32) (float64, bool) {
+	if reps == 1 {
+		return weight, true
+	}
+
+	return weight * (1 + float64(reps)/30), true
+}
+
+func brzycki(weight float64, reps int, _ *float32) (float64, bool) {
+	if reps > 12 {
+		return 0, false
+	}
+
+	return weight * 36 / (37 - float64(reps)), true
+}
+
+func rpe(weight float64, reps int, rir *float32) (float64, bool) {
+	toFailure := float64(reps)
+	if rir != nil && *rir > 0 {
+		toFailure += float64(*rir)
+	}
+
+	i := int(math.Round(toFailure*2)) - 2
+	if i >= len(rpeChart) {
+		return 0, false
+	}
+
+	return weight / rpeChart[i], true
+}
@@ -0,0 +1,65 @@
+package throttle
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps state in process, it is only correct when a single
+// instance of the API is running. Keys without a failure or lock in the last
+// retention period are dropped.
+type MemoryStore struct {
+	retention time.Duration
+
+	mu        sync.Mutex
+	states    map[string]State
+	lastSweep time.Time
+}
+
+func NewMemoryStore(retention time.Duration) *MemoryStore {
+	return &MemoryStore{
+		retention: retention,
+		states:    make(map[string]State),
+	}
+}
+
+func (m *MemoryStore) Get(ctx context.Context, key string) (State, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.states[key], nil
+}
+
+func (m *MemoryStore) RecordFailure(ctx context.Context, key string, policy Policy, now time.Time) (State, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	state := policy.Fail(m.states[key], now)
+	m.states[key] = state
+	m.sweep(now)
+
+	return state, nil
+}
+
+func (m *MemoryStore) Reset(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.states, key)
+
+	return nil
+}
+
+// sweep drops keys that can no longer affect an attempt
+func (m *MemoryStore) sweep(now time.Time) {
+	if now.Sub(m.lastSweep) < time.Minute {
+		return
+	}
+
+	m.lastSweep = now
+	for key, state := range m.states {
+		if now.Sub(state.LastFailure) > m.retention && now.After(state.LockedUntil) {
+			delete(m.states, key)
+		}
+	}
+}
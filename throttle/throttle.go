@@ -0,0 +1,133 @@
+package throttle
+
+import (
+	"context"
+	"time"
+)
+
+// Policy describes how failed attempts against a single key (a username or
+// an IP) are slowed down. Each failure doubles the wait before the next
+// attempt, starting at BaseDelay and capped at MaxDelay. Reaching MaxFailures
+// locks the key for Lockout. Failures older than Window are forgotten.
+type Policy struct {
+	MaxFailures int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+	Lockout     time.Duration
+	Window      time.Duration
+}
+
+type State struct {
+	Failures    int
+	LastFailure time.Time
+	LockedUntil time.Time
+}
+
+// RetryAfter returns how long the key has to wait before its next attempt
+func (p Policy) RetryAfter(s State, now time.Time) time.Duration {
+	wait := s.LockedUntil.Sub(now)
+	if s.Failures > 0 && now.Sub(s.LastFailure) <= p.Window {
+		if backoff := s.LastFailure.Add(p.delay(s.Failures)).Sub(now); backoff > wait {
+			wait = backoff
+		}
+	}
+	if wait < 0 {
+		return 0
+	}
+
+	return wait
+}
+
+// Fail returns the state after one more failed attempt
+func (p Policy) Fail(s State, now time.Time) State {
+	if now.Sub(s.LastFailure) > p.Window {
+		s = State{}
+	}
+
+	s.Failures++
+	s.LastFailure = now
+	if s.Failures >= p.MaxFailures {
+		s.LockedUntil = now.Add(p.Lockout)
+	}
+
+	return s
+}
+
+func (p Policy) delay(failures int) time.Duration {
+	delay := p.BaseDelay
+	for i := 1; i < failures && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > p.MaxDelay {
+		return p.MaxDelay
+	}
+
+	return delay
+}
+
+// Store keeps throttle state per key. RecordFailure must apply policy.Fail
+// atomically so concurrent failures are all counted.
+type Store interface {
+	Get(ctx context.Context, key string) (State, error)
+	RecordFailure(ctx context.Context, key string, policy Policy, now time.Time) (State, error)
+	Reset(ctx context.Context, key string) error
+}
+
+// Limiter tracks sign in failures per username and per IP
+type Limiter struct {
+	Store    Store
+	Username Policy
+	IP       Policy
+}
+
+// UsernameKey is the key of the throttle state of username in a Store
+func UsernameKey(username string) string { return "user:" + username }
+func ipKey(ip string) string             { return "ip:" + ip }
+
+// Check returns how long the caller has to wait before attempting to sign in
+// as username from ip, zero when the attempt may go ahead.
+func (l *Limiter) Check(ctx context.Context, username, ip string) (time.Duration, error) {
+	now := time.Now()
+	userState, err := l.Store.Get(ctx, UsernameKey(username))
+	if err != nil {
+		return 0, err
+	}
+
+	ipState, err := l.Store.Get(ctx, ipKey(ip))
+	if err != nil {
+		return 0, err
+	}
+
+	return maxDuration(l.Username.RetryAfter(userState, now), l.IP.RetryAfter(ipState, now)), nil
+}
+
+// Failure records a failed attempt and returns how long the caller now has
+// to wait.
+func (l *Limiter) Failure(ctx context.Context, username, ip string) (time.Duration, error) {
+	now := time.Now()
+	userState, err := l.Store.RecordFailure(ctx, UsernameKey(username), l.Username, now)
+	if err != nil {
+		return 0, err
+	}
+
+	ipState, err := l.Store.RecordFailure(ctx, ipKey(ip), l.IP, now)
+	if err != nil {
+		return 0, err
+	}
+
+	return maxDuration(l.Username.RetryAfter(userState, now), l.IP.RetryAfter(ipState, now)), nil
+}
+
+// Success clears the failures of username. The IP is left alone, otherwise
+// signing in to one account would reset guessing against all the others.
+func (l *Limiter) Success(ctx context.Context, username string) error {
+	return l.Store.Reset(ctx, UsernameKey(username))
+}
+
+func maxDuration(a, b time.Duration) time.Duration {
+	if a > b {
+		return a
+	}
+
+	return b
+}
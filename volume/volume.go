@@ -0,0 +1,155 @@
+// Package volume counts the hard sets each muscle group gets per week and
+// compares them against the volume landmarks of the lifter.
+package volume
+
+import (
+	"github.com/rekram1-node/workout-backend/catalog"
+	"github.com/rekram1-node/workout-backend/models"
+)
+
+// Status of the planned sets of a muscle relative to its landmarks
+const (
+	BelowMEV = "below_mev"
+	MEVToMAV = "mev_mav"
+	MAVToMRV = "mav_mrv"
+	AboveMRV = "above_mrv"
+)
+
+// DefaultSecondaryCredit is how much of a set counts for the secondary
+// muscles of an exercise
+const DefaultSecondaryCredit = 0.5
+
+// MaxHardSetRIR is the most reps in reserve a logged set can be left with and
+// still count as a hard set
+const MaxHardSetRIR = 4
+
+// Landmarks are the weekly sets a lifter needs to grow (MEV), grows best with
+// (MAV) and can recover from (MRV)
+type Landmarks struct {
+	MEV int `json:"mev"`
+	MAV int `json:"mav"`
+	MRV int `json:"mrv"`
+}
+
+type Muscle struct {
+	Muscle string `json:"muscle"`
+	// Sets are the planned sets of the week, CompletedSets the ones that were
+	// logged as hard sets
+	Sets          float64    `json:"sets"`
+	CompletedSets float64    `json:"completed_sets"`
+	Landmarks     *Landmarks `json:"landmarks,omitempty"`
+	Status        string     `json:"status,omitempty"`
+}
+
+type Week struct {
+	Number  int      `json:"number"`
+	Deload  bool     `json:"deload"`
+	Muscles []Muscle `json:"muscles"`
+	// Unmatched are the lifts without a catalog exercise, they aren't counted
+	Unmatched []string `json:"unmatched,omitempty"`
+}
+
+// Weekly counts the sets of every week. exercises maps catalog IDs to their
+// exercise, landmarks muscles to the lifter's landmarks.
+func Weekly(weeks []models.Week, exercises map[string]*models.Exercise, landmarks map[string]Landmarks, secondaryCredit float64) []Week {
+	result := make([]Week, 0, len(weeks))
+	for i := range weeks {
+		number := weeks[i].Number
+		if number == 0 {
+			number = i + 1
+		}
+		result = append(result, count(&weeks[i], number, exercises, landmarks, secondaryCredit))
+	}
+
+	return result
+}
+
+func count(week *models.Week, number int, exercises map[string]*models.Exercise, landmarks map[string]Landmarks, secondaryCredit float64) Week {
+	planned := map[string]float64{}
+	completed := map[string]float64{}
+	unmatched := []string{}
+
+	credit := func(muscles []string, sets, hard, share float64) {
+		for _, muscle := range muscles {
+			planned[muscle] += sets * share
+			completed[muscle] += hard * share
+		}
+	}
+
+	for _, day := range week.Days() {
+		if day == nil || day.Lifts == nil {
+			continue
+		}
+		for _, lift := range *day.Lifts {
+			exercise, ok := exercises[lift.ExerciseID]
+			if !ok {
+				unmatched = append(unmatched, lift.Exercise)
+				continue
+			}
+
+			sets, hard := float64(len(lift.Sets)), float64(hardSets(lift.Sets))
+			credit(exercise.PrimaryMuscles, sets, hard, 1)
+			credit(exercise.SecondaryMuscles, sets, hard, secondaryCredit)
+		}
+	}
+
+	result := Week{
+		Number:    number,
+		Deload:    week.Deload,
+		Muscles:   []Muscle{},
+		Unmatched: unmatched,
+	}
+	for _, muscle := range catalog.Muscles {
+		marks, hasMarks := landmarks[muscle]
+		if planned[muscle] == 0 && !hasMarks {
+			continue
+		}
+
+		m := Muscle{
+			Muscle:        muscle,
+			Sets:          planned[muscle],
+			CompletedSets: completed[muscle],
+		}
+		if hasMarks {
+			m.Landmarks = &marks
+			m.Status = Status(m.Sets, marks)
+		}
+		result.Muscles = append(result.Muscles, m)
+	}
+
+	return result
+}
+
+// hardSets counts the completed sets, leaving out the ones logged far from
+// failure
+func hardSets(sets []models.Set) int {
+	hard := 0
+	for _, set := range sets {
+		if !set.Completed {
+			continue
+		}
+		if set.RIR != nil && *set.RIR > MaxHardSetRIR {
+			continue
+		}
+		if set.RPE != nil && 10-*set.RPE > MaxHardSetRIR {
+			continue
+		}
+		hard++
+	}
+
+	return hard
+}
+
+// Status places sets between the landmarks
+func Status(sets float64, landmarks Landmarks) string {
+	switch {
+	case sets < float64(landmarks.MEV):
+		return BelowMEV
+	case sets <= float64(landmarks.MAV):
+		return MEVToMAV
+	case sets <= float64(landmarks.MRV):
+		return MAVToMRV
+	default:
+		return AboveMRV
+	}
+}